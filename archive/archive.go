@@ -0,0 +1,379 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Format is a container or compression format
+type Format string
+
+const (
+	Raw   Format = "raw"
+	Tar   Format = "tar"
+	Zip   Format = "zip"
+	Gzip  Format = "gzip"
+	Bzip2 Format = "bzip2"
+	Xz    Format = "xz"
+	Zstd  Format = "zstd"
+)
+
+var magic = []struct {
+	format Format
+	offset int
+	bytes  []byte
+}{
+	{Gzip, 0, []byte{0x1f, 0x8b}},
+	{Bzip2, 0, []byte("BZh")},
+	{Xz, 0, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{Zstd, 0, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{Zip, 0, []byte("PK\x03\x04")},
+	{Tar, 257, []byte("ustar")},
+}
+
+// detect identifies the format of the data at the start of r without consuming it
+func detect(r *bufio.Reader) Format {
+	header, _ := r.Peek(512)
+
+	for _, m := range magic {
+		if len(header) >= m.offset+len(m.bytes) && bytes.Equal(header[m.offset:m.offset+len(m.bytes)], m.bytes) {
+			return m.format
+		}
+	}
+
+	return Raw
+}
+
+// Detect returns the outermost format of a file
+func Detect(file string) (Format, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	return detect(bufio.NewReader(f)), nil
+}
+
+// decompress wraps r in a decompressor for format
+func decompress(format Format, r io.Reader) (io.ReadCloser, error) {
+	switch format {
+	case Gzip:
+		return gzip.NewReader(r)
+	case Bzip2:
+		return ioutil.NopCloser(bzip2.NewReader(r)), nil
+	case Xz:
+		x, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(x), nil
+	case Zstd:
+		z, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return z.IOReadCloser(), nil
+	}
+
+	return nil, fmt.Errorf("%s is not a compression format", format)
+}
+
+// Mapping picks members of an archive to install and says where they go
+type Mapping struct {
+	// Pattern is a glob matched against both the full path of a member and its base name
+	Pattern string
+	// Target returns the path to install a matching member to
+	Target func(member string) string
+	// Mode is the permission given to installed files
+	Mode os.FileMode
+	// Required makes extraction fail if no member matches
+	Required bool
+}
+
+// Extract installs files from an archive. Tar archives (optionally compressed with gzip,
+// bzip2, xz or zstd) and zip files are searched for members matching the mappings. Each
+// member is installed using the first mapping whose pattern matches its full path or,
+// failing that, the first that matches its base name. Two members can't be installed to the
+// same place, and every Required mapping must match something. A single compressed file,
+// or a file that isn't an archive at all, is installed using the first mapping, as if it
+// was a member called name.
+//
+// Members are written next to their targets and only renamed into place once the whole
+// archive has been read and checked, so a bad archive leaves nothing behind. The paths
+// written are returned, including on error if some were renamed before another failed.
+func Extract(file, name string, mappings []Mapping) ([]string, error) {
+	if len(mappings) == 0 {
+		return nil, fmt.Errorf("nothing to extract from %s", file)
+	}
+
+	x := newExtraction(mappings)
+	if err := x.extract(file, name); err != nil {
+		x.abort()
+		return nil, err
+	}
+
+	return x.commit()
+}
+
+func (x *extraction) extract(file, name string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	format := detect(r)
+
+	switch format {
+	case Zip:
+		return x.extractZip(file)
+	case Tar:
+		return x.extractTar(r)
+	case Raw:
+		return x.stage(x.mappings[0].Target(name), x.mappings[0].Mode, r)
+	}
+
+	d, err := decompress(format, r)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	inner := bufio.NewReader(d)
+	if detect(inner) == Tar {
+		return x.extractTar(inner)
+	}
+
+	return x.stage(x.mappings[0].Target(name), x.mappings[0].Mode, inner)
+}
+
+func (x *extraction) extractTar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		member, err := cleanMember(hdr.Name)
+		if err != nil {
+			return err
+		}
+
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		mapping, target, err := x.match(member)
+		if err != nil {
+			return err
+		}
+		if mapping == nil {
+			continue
+		}
+
+		if err := x.stage(target, mapping.Mode, tr); err != nil {
+			return err
+		}
+	}
+
+	return x.check()
+}
+
+func (x *extraction) extractZip(file string) error {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, zf := range zr.File {
+		member, err := cleanMember(zf.Name)
+		if err != nil {
+			return err
+		}
+
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+
+		mapping, target, err := x.match(member)
+		if err != nil {
+			return err
+		}
+		if mapping == nil {
+			continue
+		}
+
+		rc, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		err = x.stage(target, mapping.Mode, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return x.check()
+}
+
+// extraction tracks which mappings have matched members of an archive, and where they
+// will be installed
+type extraction struct {
+	mappings []Mapping
+	matched  []bool
+	// targets maps each path to be written to the member written there
+	targets map[string]string
+	// staged holds the temporary file written for each target, in the order they were read
+	staged []staged
+}
+
+type staged struct {
+	tmp, target string
+}
+
+func newExtraction(mappings []Mapping) *extraction {
+	return &extraction{
+		mappings: mappings,
+		matched:  make([]bool, len(mappings)),
+		targets:  map[string]string{},
+	}
+}
+
+// match returns the mapping for member and where to install it, or nil if it isn't wanted
+func (x *extraction) match(member string) (*Mapping, string, error) {
+	i := matchMember(member, x.mappings)
+	if i < 0 {
+		return nil, "", nil
+	}
+
+	mapping := &x.mappings[i]
+	target := mapping.Target(member)
+	if other, ok := x.targets[target]; ok {
+		return nil, "", fmt.Errorf("archive members %s and %s would both be installed to %s", other, member, target)
+	}
+	x.targets[target] = member
+	x.matched[i] = true
+
+	return mapping, target, nil
+}
+
+// check returns an error if a required mapping, or every mapping, matched nothing
+func (x *extraction) check() error {
+	var missing []string
+	for i, m := range x.mappings {
+		if m.Required && !x.matched[i] {
+			missing = append(missing, m.Pattern)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("no files matching %s in archive", strings.Join(missing, ", "))
+	}
+
+	if len(x.targets) == 0 {
+		var patterns []string
+		for _, m := range x.mappings {
+			patterns = append(patterns, m.Pattern)
+		}
+		return fmt.Errorf("no files matching %s in archive", strings.Join(patterns, ", "))
+	}
+
+	return nil
+}
+
+// stage writes r to a temporary file next to target. Writing it in the same directory
+// means it can be renamed into place, so replacing a binary that is running doesn't fail.
+func (x *extraction) stage(target string, mode os.FileMode, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(target), "."+filepath.Base(target)+".jat")
+	if err != nil {
+		return err
+	}
+	x.staged = append(x.staged, staged{tmp: tmp.Name(), target: target})
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Chmod(tmp.Name(), mode)
+}
+
+// commit renames every staged file into place, returning the paths written
+func (x *extraction) commit() ([]string, error) {
+	var written []string
+	for i, s := range x.staged {
+		if err := os.Rename(s.tmp, s.target); err != nil {
+			x.staged = x.staged[i:]
+			x.abort()
+			return written, err
+		}
+		written = append(written, s.target)
+	}
+	x.staged = nil
+
+	return written, nil
+}
+
+// abort removes staged files that haven't been renamed into place
+func (x *extraction) abort() {
+	for _, s := range x.staged {
+		os.Remove(s.tmp)
+	}
+	x.staged = nil
+}
+
+// cleanMember normalises a path from an archive, refusing any that would escape the
+// directory it is extracted into
+func cleanMember(name string) (string, error) {
+	clean := path.Clean(strings.TrimPrefix(name, "./"))
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("archive member %q is outside the archive root", name)
+	}
+	return clean, nil
+}
+
+// matchMember returns the index of the first mapping whose pattern matches member or,
+// failing that, the first that matches its base name, or -1 if none do. Trying full paths
+// first stops a file like completions/helm being taken for the helm binary when it has a
+// mapping of its own.
+func matchMember(member string, mappings []Mapping) int {
+	for i, m := range mappings {
+		if ok, _ := path.Match(m.Pattern, member); ok {
+			return i
+		}
+	}
+	for i, m := range mappings {
+		if ok, _ := path.Match(m.Pattern, path.Base(member)); ok {
+			return i
+		}
+	}
+	return -1
+}
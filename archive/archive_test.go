@@ -0,0 +1,335 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// bzip2 has no writer in the standard library, so these were made with bzip2 -9: a tar
+// holding tool-1.0/bin/tool, and "tool binary\n" on its own
+const (
+	tarBzip2 = "QlpoOTFBWSZTWWFOAw0AANp/hMqQEEBAA/+AAACIgHAlniAAAIAIIACShkp6BAABoAAiopptTyTQMgNDamTWr7vOGBY7UApIQHHAxkXDNvLIsh5MEQihpENjVi8Q6ucmFsVezNiA+csqAz5jEyPLDmqoh12UzowwbSMA8ObiVM0rpBAoDobYi761SrBLU7jEas3Njo2Do3a6QNWlEQ/i7kinChIMKcBhoA=="
+	rawBzip2 = "QlpoOTFBWSZTWafsnsEAAAVRgAAQQAAwJZQgIAAxANNNBABiLevQIRK8XckU4UJCn7J7BA=="
+)
+
+const content = "tool binary\n"
+
+func makeTar(t *testing.T, files map[string]string) []byte {
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	for name, body := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(body))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func makeZip(t *testing.T, files map[string]string) []byte {
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for name, body := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func compress(t *testing.T, format Format, data []byte) []byte {
+	var b bytes.Buffer
+	switch format {
+	case Gzip:
+		w := gzip.NewWriter(&b)
+		w.Write(data)
+		w.Close()
+	case Xz:
+		w, err := xz.NewWriter(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+		w.Close()
+	case Zstd:
+		w, err := zstd.NewWriter(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+		w.Close()
+	default:
+		t.Fatalf("can't compress with %s", format)
+	}
+	return b.Bytes()
+}
+
+func decode(t *testing.T, s string) []byte {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func writeArchive(t *testing.T, data []byte) string {
+	file := filepath.Join(t.TempDir(), "download")
+	if err := ioutil.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestDetect(t *testing.T) {
+	tarball := makeTar(t, map[string]string{"tool": content})
+
+	tests := []struct {
+		name string
+		data []byte
+		want Format
+	}{
+		{"tar", tarball, Tar},
+		{"zip", makeZip(t, map[string]string{"tool": content}), Zip},
+		{"gzip", compress(t, Gzip, tarball), Gzip},
+		{"bzip2", decode(t, tarBzip2), Bzip2},
+		{"xz", compress(t, Xz, tarball), Xz},
+		{"zstd", compress(t, Zstd, tarball), Zstd},
+		{"raw", []byte("\x7fELF..."), Raw},
+		{"empty", nil, Raw},
+	}
+
+	for _, tt := range tests {
+		got, err := Detect(writeArchive(t, tt.data))
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: detected %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tarball := makeTar(t, map[string]string{
+		"tool-1.0/bin/tool": content,
+		"tool-1.0/README":   "read me\n",
+	})
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"tar", tarball},
+		{"tar.gz", compress(t, Gzip, tarball)},
+		{"tar.bz2", decode(t, tarBzip2)},
+		{"tar.xz", compress(t, Xz, tarball)},
+		{"tar.zst", compress(t, Zstd, tarball)},
+		{"zip", makeZip(t, map[string]string{"tool-1.0/bin/tool": content, "tool-1.0/README": "read me\n"})},
+		{"gz", compress(t, Gzip, []byte(content))},
+		{"bz2", decode(t, rawBzip2)},
+		{"xz", compress(t, Xz, []byte(content))},
+		{"zst", compress(t, Zstd, []byte(content))},
+		{"raw", []byte(content)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			target := filepath.Join(dir, "tool")
+			mappings := []Mapping{{
+				Pattern: "tool",
+				Target:  func(string) string { return target },
+				Mode:    0755,
+			}}
+
+			written, err := Extract(writeArchive(t, tt.data), "tool", mappings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(written) != 1 || written[0] != target {
+				t.Fatalf("wrote %v, want %s", written, target)
+			}
+
+			b, err := ioutil.ReadFile(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != content {
+				t.Errorf("extracted %q, want %q", b, content)
+			}
+		})
+	}
+}
+
+func TestExtractRefusesTraversal(t *testing.T) {
+	members := []string{
+		"../tool",
+		"tool-1.0/../../tool",
+		"/tmp/tool",
+	}
+
+	for _, member := range members {
+		for _, kind := range []string{"tar", "zip"} {
+			t.Run(kind+":"+member, func(t *testing.T) {
+				files := map[string]string{member: content}
+				data := makeTar(t, files)
+				if kind == "zip" {
+					data = makeZip(t, files)
+				}
+
+				dir := t.TempDir()
+				mappings := []Mapping{{
+					Pattern: "tool",
+					Target:  func(m string) string { return filepath.Join(dir, m) },
+					Mode:    0755,
+				}}
+
+				if written, err := Extract(writeArchive(t, data), "tool", mappings); err == nil {
+					t.Errorf("extracted %v, want an error", written)
+				}
+			})
+		}
+	}
+}
+
+func TestExtractNoMatches(t *testing.T) {
+	data := makeTar(t, map[string]string{"README": "read me\n"})
+	mappings := []Mapping{{
+		Pattern: "tool",
+		Target:  func(m string) string { return filepath.Join(t.TempDir(), m) },
+	}}
+
+	if _, err := Extract(writeArchive(t, data), "tool", mappings); err == nil {
+		t.Error("extracted an archive with nothing matching")
+	}
+}
+
+func TestExtractPrefersFullPathMatches(t *testing.T) {
+	data := makeTar(t, map[string]string{
+		"helm/helm":             content,
+		"helm/completions/helm": "complete -F _helm helm\n",
+	})
+
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "bin", "helm")
+	completion := filepath.Join(dir, "completions", "helm")
+	mappings := []Mapping{
+		{Pattern: "helm", Target: func(string) string { return binary }, Mode: 0755, Required: true},
+		{Pattern: "helm/completions/helm", Target: func(string) string { return completion }, Mode: 0644},
+	}
+
+	if _, err := Extract(writeArchive(t, data), "helm", mappings); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, want := range map[string]string{binary: content, completion: "complete -F _helm helm\n"} {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("%s holds %q, want %q", file, b, want)
+		}
+	}
+}
+
+func TestExtractRequired(t *testing.T) {
+	data := makeTar(t, map[string]string{"tool-1.0/README": "read me\n"})
+
+	dir := t.TempDir()
+	mappings := []Mapping{
+		{Pattern: "tool", Target: func(m string) string { return filepath.Join(dir, "bin", m) }, Required: true},
+		{Pattern: "README", Target: func(m string) string { return filepath.Join(dir, "doc", "README") }},
+	}
+
+	if written, err := Extract(writeArchive(t, data), "tool", mappings); err == nil {
+		t.Errorf("extracted %v without the required binary", written)
+	}
+	if files := leftovers(t, dir); len(files) > 0 {
+		t.Errorf("failed extraction left %q behind", files)
+	}
+}
+
+func TestExtractRefusesOverwrite(t *testing.T) {
+	data := makeTar(t, map[string]string{
+		"linux/tool": content,
+		"docs/tool":  "not a binary\n",
+	})
+
+	dir := t.TempDir()
+	mappings := []Mapping{
+		{Pattern: "tool", Target: func(m string) string { return filepath.Join(dir, "tool") }, Required: true},
+	}
+
+	if written, err := Extract(writeArchive(t, data), "tool", mappings); err == nil {
+		t.Errorf("extracted %v, installing two members to the same place", written)
+	}
+	if files := leftovers(t, dir); len(files) > 0 {
+		t.Errorf("failed extraction left %q behind", files)
+	}
+}
+
+func TestExtractKeepsExistingFilesOnError(t *testing.T) {
+	data := makeTar(t, map[string]string{
+		"tool-1.0/tool":    content,
+		"tool-1.0/README":  "read me\n",
+		"tool-1.0/LICENSE": "MIT\n",
+	})
+
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "tool")
+	if err := ioutil.WriteFile(binary, []byte("old binary\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	mappings := []Mapping{
+		{Pattern: "tool", Target: func(string) string { return binary }, Mode: 0755},
+		{Pattern: "*", Target: func(string) string { return filepath.Join(dir, "doc") }},
+	}
+
+	if written, err := Extract(writeArchive(t, data), "tool", mappings); err == nil {
+		t.Fatalf("extracted %v, installing two members to the same place", written)
+	}
+	if b, err := ioutil.ReadFile(binary); err != nil || string(b) != "old binary\n" {
+		t.Errorf("got %q, %v; the old binary was replaced", b, err)
+	}
+	if files := leftovers(t, dir); !reflect.DeepEqual(files, []string{"tool"}) {
+		t.Errorf("got %q in %s, want just the old binary", files, dir)
+	}
+}
+
+// leftovers lists the files under dir, relative to it
+func leftovers(t *testing.T, dir string) []string {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		files = append(files, rel)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
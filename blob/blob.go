@@ -15,17 +15,23 @@ import (
 	"sync"
 	"text/template"
 
+	"github.com/dooferlad/jat/archive"
 	"github.com/dooferlad/jat/dpkg"
+	"github.com/dooferlad/jat/plan"
+	"github.com/dooferlad/jat/report"
 	"github.com/dooferlad/jat/shell"
+	"github.com/dooferlad/jat/state"
 	"github.com/dooferlad/jat/utils"
+	"github.com/dooferlad/jat/version"
 	"github.com/google/shlex"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
-// Update checks for updates to binary packages, installing any it finds
-func Update(args []string) error {
+// Update checks for updates to binary packages, installing any it finds. The outcome for
+// each package is added to rep.
+func Update(ctx context.Context, r shell.Runner, rep *report.Report, args []string) error {
 	var config Config
 	err := viper.Unmarshal(&config)
 	if err != nil {
@@ -41,9 +47,13 @@ func Update(args []string) error {
 			wg.Add(1)
 
 			go func(name string, info BinaryPackage) {
-				if err := checkAndUpdateBinary(name, info); err != nil {
-					logrus.Errorf("while downloading %s: %s", name, err)
-				}
+				rep.Time("blob", name, func() (report.Entry, error) {
+					entry, err := checkAndUpdateBinary(ctx, r, name, info)
+					if err != nil {
+						logrus.Errorf("while downloading %s: %s", name, err)
+					}
+					return entry, err
+				})
 				wg.Done()
 			}(name, info)
 		}
@@ -51,11 +61,12 @@ func Update(args []string) error {
 
 	wg.Wait()
 
-	return nil
+	// Stop here rather than carrying on with the rest of an update that was interrupted
+	return ctx.Err()
 }
 
 // Install looks for a matching binary package and, if found, installs it
-func Install(packageName string) error {
+func Install(ctx context.Context, r shell.Runner, packageName string) error {
 	var config Config
 	err := viper.Unmarshal(&config)
 	if err != nil {
@@ -64,7 +75,7 @@ func Install(packageName string) error {
 
 	for name, info := range config.BinaryBlobs {
 		if name == packageName {
-			return installBinary(name, info)
+			return installBinary(ctx, r, name, info)
 		}
 	}
 
@@ -101,6 +112,11 @@ type BinaryPackage struct {
 	VersionURL        string   `mapstructure:"version_url"`
 	VersionURLRegex   string   `mapstructure:"version_url_regex"`
 	GithubRepo        string   `mapstructure:"github"`
+	Checksum          string   `mapstructure:"checksum"`
+	ChecksumURL       string   `mapstructure:"checksum_url"`
+	Verify            *Verification
+	Members           []string
+	Files             []FileMapping
 }
 
 type Config struct {
@@ -113,19 +129,26 @@ type Meta struct {
 	DownloadedFile string
 	Name           string
 	TempDir        string
+	DownloadURL    string
+	FileName       string
 }
 
-func checkAndUpdateBinary(name string, info BinaryPackage) error {
-	var version, downloadURL string
+func checkAndUpdateBinary(ctx context.Context, r shell.Runner, name string, info BinaryPackage) (report.Entry, error) {
+	var localVersion, downloadURL string
 	downloadURL = info.DownloadURL
 
+	entry := report.Entry{
+		Name:   name,
+		Status: report.Skipped,
+	}
+
 	m := Meta{
 		Name: name,
 	}
 
 	usr, err := user.Current()
 	if err != nil {
-		return err
+		return entry, err
 	}
 	m.HomeBinPath = filepath.Join(usr.HomeDir, "bin")
 
@@ -133,38 +156,69 @@ func checkAndUpdateBinary(name string, info BinaryPackage) error {
 		info.Name = name
 	}
 
-	if version, err = getLocalVersion(info); err != nil {
+	if localVersion, err = getLocalVersion(ctx, r, name, info); err != nil {
 		if errors.Is(err, exec.ErrNotFound) {
-			return nil // Don't worry about not being able to update something that isn't installed
+			entry.Detail = "not installed"
+			return entry, nil // Don't worry about not being able to update something that isn't installed
 		}
-		return err
+		return entry, err
 	}
 
-	if version == "" { // No version found - not installed
-		return nil
+	if localVersion == "" { // No version found - not installed
+		entry.Detail = "not installed"
+		return entry, nil
 	}
+	entry.OldVersion = localVersion
 
-	remoteVersion, newDownloadURL, err := checkVersionURL(&m, info)
+	remoteVersion, newDownloadURL, err := checkVersionURL(ctx, &m, info)
 	m.Version = remoteVersion
 	if err != nil {
-		return err
+		return entry, err
 	}
+	entry.NewVersion = remoteVersion
 
 	if newDownloadURL != "" {
 		downloadURL = newDownloadURL
 	}
 
-	if !versionMatch(remoteVersion, version) {
-		fmt.Printf("%s needs updating: %s (local: %s, remote: %s)\n", info.Name, downloadURL, version, remoteVersion)
-		return installBlob(info, m, downloadURL)
+	newer, err := version.Newer(remoteVersion, localVersion)
+	if err != nil {
+		return entry, errors.Wrapf(err, "comparing versions of %s", info.Name)
+	}
+
+	step := plan.Step{
+		Type:          "up-to-date",
+		Package:       name,
+		URL:           downloadURL,
+		LocalVersion:  localVersion,
+		RemoteVersion: remoteVersion,
+	}
+
+	if newer {
+		fmt.Printf("%s needs updating: %s (local: %s, remote: %s)\n", info.Name, downloadURL, localVersion, remoteVersion)
+		step.Type = "install"
+		plan.Add(step)
+		if plan.DryRun() {
+			entry.Detail = "dry run: " + downloadURL
+			return entry, installBlob(ctx, r, info, m, downloadURL, "update")
+		}
+
+		if err := cacheCurrent(name, info, localVersion); err != nil {
+			logrus.Warnf("unable to keep %s %s for rollback: %s", name, localVersion, err)
+		}
+		entry.Status = report.Updated
+		entry.Detail = downloadURL
+		return entry, installBlob(ctx, r, info, m, downloadURL, "update")
 	} else {
-		fmt.Printf("%s is up to date (%s)\n", info.Name, version)
+		fmt.Printf("%s is up to date (%s)\n", info.Name, localVersion)
+		plan.Add(step)
 	}
 
-	return nil
+	entry.Status = report.Unchanged
+	return entry, nil
 }
 
-func installBinary(name string, info BinaryPackage) error {
+func installBinary(ctx context.Context, r shell.Runner, name string, info BinaryPackage) error {
 	var downloadURL string
 	downloadURL = info.DownloadURL
 
@@ -182,6 +236,21 @@ func installBinary(name string, info BinaryPackage) error {
 		info.Name = name
 	}
 
+	st, err := state.Load()
+	if err != nil {
+		return err
+	}
+	if record, ok := st.Get(name); ok {
+		if info.PackageType == "deb" {
+			// Debs are recorded without files; ask dpkg whether it is still there
+			if status, err := dpkg.Query(ctx, r, info.Name); err == nil && status.Status == "install ok installed" {
+				return fmt.Errorf("%s is already installed (%s)", name, status.Version)
+			}
+		} else if filesExist(record.Files) {
+			return fmt.Errorf("%s is already installed (%s)", name, record.Version)
+		}
+	}
+
 	if _, err := os.Stat(info.Name); err != nil {
 		if !os.IsNotExist(err) {
 			// File exists, but there is a problem
@@ -192,7 +261,7 @@ func installBinary(name string, info BinaryPackage) error {
 		return fmt.Errorf("%s is already installed", name)
 	}
 
-	remoteVersion, newDownloadURL, err := checkVersionURL(&m, info)
+	remoteVersion, newDownloadURL, err := checkVersionURL(ctx, &m, info)
 	m.Version = remoteVersion
 	if err != nil {
 		return err
@@ -207,14 +276,19 @@ func installBinary(name string, info BinaryPackage) error {
 	}
 
 	fmt.Printf("%s will be installed: %s\n", info.Name, downloadURL)
-	return installBlob(info, m, downloadURL)
+	plan.Add(plan.Step{
+		Type:          "install",
+		Package:       name,
+		URL:           downloadURL,
+		RemoteVersion: remoteVersion,
+	})
+
+	return installBlob(ctx, r, info, m, downloadURL, "install")
 }
 
-func getLocalVersion(info BinaryPackage) (string, error) {
-	var version string
-
+func getLocalVersion(ctx context.Context, r shell.Runner, name string, info BinaryPackage) (string, error) {
 	if info.PackageType == "deb" {
-		dpkgStatus, err := dpkg.Query(info.Name)
+		dpkgStatus, err := dpkg.Query(ctx, r, info.Name)
 		if dpkgStatus.Status != "install ok installed" {
 			logrus.Infof("Not installed: %s, %v", info.Name, dpkgStatus)
 			return "", nil
@@ -225,42 +299,65 @@ func getLocalVersion(info BinaryPackage) (string, error) {
 		return dpkgStatus.Version, nil
 	}
 
+	// The installed binary knows its version best; fall back to our own record of what we
+	// installed if it can't say, as long as nothing has removed it since
+	localVersion, err := binaryVersion(ctx, r, info)
+	if err == nil {
+		return localVersion, nil
+	}
+
+	st, stErr := state.Load()
+	if stErr != nil {
+		return "", stErr
+	}
+	if record, ok := st.Get(name); ok && filesExist(record.Files) {
+		return record.Version, nil
+	}
+
+	return "", err
+}
+
+// binaryVersion runs the version command of a package and picks the version out of its
+// output using the version regex
+func binaryVersion(ctx context.Context, r shell.Runner, info BinaryPackage) (string, error) {
 	if _, err := exec.LookPath(info.Name); err != nil {
 		// Don't try to update a file that doesn't exist
 		return "", err
 	}
 
-	if out, err := shell.Capture(info.Name, info.VersionCommand...); err != nil {
+	out, err := r.Capture(ctx, info.Name, info.VersionCommand...)
+	if err != nil {
 		return "", errors.Wrapf(err, "Unable to find version of %s (%s)", info.Name, string(out))
-	} else {
-		const ansi = "[\u001B\u009B][[\\]()#;?]*(?:(?:(?:[a-zA-Z\\d]*(?:;[a-zA-Z\\d]*)*)?\u0007)|(?:(?:\\d{1,4}(?:;\\d{0,4})*)?[\\dA-PRZcf-ntqry=><~]))"
+	}
 
-		out = regexp.MustCompile(ansi).ReplaceAll(out, []byte{})
+	const ansi = "[\u001B\u009B][[\\]()#;?]*(?:(?:(?:[a-zA-Z\\d]*(?:;[a-zA-Z\\d]*)*)?\u0007)|(?:(?:\\d{1,4}(?:;\\d{0,4})*)?[\\dA-PRZcf-ntqry=><~]))"
 
-		versionRegex := strings.ReplaceAll(info.VersionRegex, `\j`, "[0-9.]")
-		vr, err := regexp.Compile(versionRegex)
-		if err != nil {
-			return "", err
-		}
-		v := vr.FindSubmatch(out)
-		if len(v) >= 2 {
-			version = string(v[1])
-		} else {
-			return "", fmt.Errorf("unable to parse version of %s using %s:\n%s", info.Name, versionRegex, string(out))
-		}
+	out = regexp.MustCompile(ansi).ReplaceAll(out, []byte{})
+
+	versionRegex := strings.ReplaceAll(info.VersionRegex, `\j`, "[0-9.]")
+	vr, err := regexp.Compile(versionRegex)
+	if err != nil {
+		return "", err
+	}
+	v := vr.FindSubmatch(out)
+	if len(v) < 2 {
+		return "", fmt.Errorf("unable to parse version of %s using %s:\n%s", info.Name, versionRegex, string(out))
 	}
 
-	return version, nil
+	return string(v[1]), nil
 }
 
 // checkVersionURL fetches info.VersionURL and translates it into a remote version and download URL
-func checkVersionURL(m *Meta, info BinaryPackage) (string, string, error) {
+func checkVersionURL(ctx context.Context, m *Meta, info BinaryPackage) (string, string, error) {
 	var remoteVersion, downloadURL string
 
+	ctx, cancel := utils.WithTimeout(ctx, "http")
+	defer cancel()
+
 	if info.VersionURL != "" {
 		client := &http.Client{}
 
-		req, err := http.NewRequest("GET", info.VersionURL, nil)
+		req, err := http.NewRequestWithContext(ctx, "GET", info.VersionURL, nil)
 		if err != nil {
 			return "", "", err
 		}
@@ -304,7 +401,7 @@ func checkVersionURL(m *Meta, info BinaryPackage) (string, string, error) {
 		}
 		bits := strings.Split(info.GithubRepo, "/")
 
-		releases, _, err := client.Repositories.ListReleases(context.Background(), bits[0], bits[1], nil)
+		releases, _, err := client.Repositories.ListReleases(ctx, bits[0], bits[1], nil)
 		if err != nil {
 			return "", "", err
 		}
@@ -377,7 +474,7 @@ func checkVersionURL(m *Meta, info BinaryPackage) (string, string, error) {
 		logrus.Debug("From Github:", remoteVersion, downloadURL)
 	} else if downloadURL == "" {
 		var err error
-		remoteVersion, downloadURL, err = utils.VersionFromURL(info.URL, info.Selector, info.Regexp, info.Name, info.DownloadURL)
+		remoteVersion, downloadURL, err = utils.VersionFromURL(ctx, info.URL, info.Selector, info.Regexp, info.Name, info.DownloadURL)
 		if err != nil {
 			return "", "", err
 		}
@@ -407,7 +504,20 @@ func checkVersionURL(m *Meta, info BinaryPackage) (string, string, error) {
 	return remoteVersion, downloadURL, nil
 }
 
-func installBlob(info BinaryPackage, m Meta, downloadURL string) error {
+// installBlob downloads, checks and installs a package. In a dry run nothing is downloaded;
+// the commands that would be run and the files that would be extracted are planned instead.
+func installBlob(ctx context.Context, r shell.Runner, info BinaryPackage, m Meta, downloadURL, action string) error {
+	m.DownloadURL = downloadURL
+	m.FileName = downloadFileName(downloadURL)
+	info.InstallCommands = installCommands(info)
+
+	if plan.DryRun() {
+		// Commands are planned with the path the download would have been saved to
+		m.TempDir = filepath.Join(os.TempDir(), "jat")
+		m.DownloadedFile = filepath.Join(m.TempDir, m.Name)
+		return planBlob(ctx, r, info, m)
+	}
+
 	dir, err := ioutil.TempDir("", "jat")
 	if err != nil {
 		return err
@@ -416,50 +526,124 @@ func installBlob(info BinaryPackage, m Meta, downloadURL string) error {
 
 	m.TempDir = dir
 	m.DownloadedFile = filepath.Join(dir, m.Name)
-	if err := utils.DownloadFile(downloadURL, m.DownloadedFile); err != nil {
+	if err := utils.DownloadFile(ctx, downloadURL, m.DownloadedFile); err != nil {
 		return err
 	}
 
-	if info.PackageType == "deb" {
-		info.InstallCommands = []string{
-			"sudo dpkg -i {{ .DownloadedFile }}",
-		}
+	// Nothing from the download gets run until it has been checked
+	if err := verifyChecksum(ctx, info, m); err != nil {
+		return err
+	}
+	if err := verifySignature(ctx, info, m); err != nil {
+		return err
+	}
+
+	checksum, err := utils.FileSHA256(m.DownloadedFile)
+	if err != nil {
+		return err
 	}
 
 	if info.InstallPreCommand != "" {
-		if err := executeTemplate(info.InstallPreCommand, m); err != nil {
+		if err := executeTemplate(ctx, r, info.InstallPreCommand, m); err != nil {
 			return err
 		}
 	}
 
+	var files []string
 	if len(info.InstallCommands) == 0 {
-		if strings.HasSuffix(downloadURL, ".tar.gz") ||
-			strings.HasSuffix(downloadURL, ".tar.bz") ||
-			strings.HasSuffix(downloadURL, ".tar.xz") ||
-			strings.HasSuffix(downloadURL, ".tar.bz2") {
-			info.InstallCommands = []string{
-				"tar -C {{ .HomeBinPath }} -xf {{ .DownloadedFile }} {{ .Name }}",
-			}
-		} else if strings.HasSuffix(downloadURL, ".zip") {
-			info.InstallCommands = []string{
-				"unzip -o -d {{ .HomeBinPath }} {{ .DownloadedFile }} {{ .Name }}",
-			}
-		} else if strings.HasSuffix(downloadURL, ".bz2") {
-			info.InstallCommands = []string{
-				"mv {{ .DownloadedFile }} {{ .HomeBinPath }}/{{ .Name }}.bz2",
-				"bunzip2 --force {{ .HomeBinPath }}/{{ .Name }}.bz2",
+		targets, err := mappings(info, m)
+		if err != nil {
+			return err
+		}
+		if files, err = archive.Extract(m.DownloadedFile, m.Name, targets); err != nil {
+			if len(files) > 0 {
+				logrus.Warnf("%s: only partly installed, %s was written", m.Name, strings.Join(files, ", "))
 			}
-		} else {
-			info.InstallCommands = []string{
-				"mv {{ .DownloadedFile }} {{ .HomeBinPath }}",
+			return errors.Wrapf(err, "installing %s", m.Name)
+		}
+		fmt.Printf("%s: installed %s\n", m.Name, strings.Join(files, ", "))
+	}
+
+	for _, c := range info.InstallCommands {
+		if err := executeTemplate(ctx, r, c, m); err != nil {
+			return err
+		}
+	}
+
+	record := state.Record{
+		Name:        m.Name,
+		Action:      action,
+		Version:     m.Version,
+		PackageType: info.PackageType,
+		DownloadURL: downloadURL,
+		Checksum:    checksum,
+	}
+
+	if files != nil {
+		record.Files = files
+	} else if info.PackageType != "deb" {
+		binary := filepath.Join(m.HomeBinPath, m.Name)
+		if _, err := os.Stat(binary); err == nil {
+			record.Files = append(record.Files, binary)
+		}
+	}
+
+	cached := record.Files
+	if info.PackageType == "deb" {
+		cached = []string{m.DownloadedFile}
+	}
+	if err := cachePackage(m.Name, info.PackageType, m.Version, checksum, cached); err != nil {
+		logrus.Warnf("unable to keep %s %s for rollback: %s", m.Name, m.Version, err)
+	}
+
+	return state.Update(func(s *state.State) error {
+		if previous, ok := s.Get(record.Name); ok && info.PackageType != "deb" {
+			if err := removeStale(previous.Files, record.Files); err != nil {
+				return err
 			}
 		}
+		s.Add(record)
+		return nil
+	})
+}
+
+// installCommands returns the commands that install a package, or nil if its files are
+// extracted from the download
+func installCommands(info BinaryPackage) []string {
+	if info.PackageType == "deb" {
+		return []string{"sudo dpkg -i {{ .DownloadedFile }}"}
+	}
+	return info.InstallCommands
+}
+
+// planBlob plans the commands installBlob would run and the files it would extract
+func planBlob(ctx context.Context, r shell.Runner, info BinaryPackage, m Meta) error {
+	if info.InstallPreCommand != "" {
+		if err := executeTemplate(ctx, r, info.InstallPreCommand, m); err != nil {
+			return err
+		}
+	}
 
-		info.InstallCommands = append(info.InstallCommands, "chmod +x {{ .HomeBinPath }}/{{ .Name }}")
+	if len(info.InstallCommands) == 0 {
+		targets, err := mappings(info, m)
+		if err != nil {
+			return err
+		}
+		for _, t := range targets {
+			step := plan.Step{
+				Type:    "extract",
+				Package: m.Name,
+				URL:     m.DownloadURL,
+				Member:  t.Pattern,
+				Files:   []string{t.Target(t.Pattern)},
+			}
+			plan.Add(step)
+			fmt.Println("[dry-run]", step)
+		}
 	}
 
 	for _, c := range info.InstallCommands {
-		if err := executeTemplate(c, m); err != nil {
+		if err := executeTemplate(ctx, r, c, m); err != nil {
 			return err
 		}
 	}
@@ -467,7 +651,52 @@ func installBlob(info BinaryPackage, m Meta, downloadURL string) error {
 	return nil
 }
 
-func executeTemplate(commandTemplate string, m Meta) error {
+// cacheCurrent keeps a copy of the installed version of a package, so that there is
+// something to roll back to after it is updated. Only files jat manages are cached, so a
+// rollback never writes to system directories. Debs can only be rolled back to versions
+// jat downloaded.
+func cacheCurrent(name string, info BinaryPackage, localVersion string) error {
+	if info.PackageType == "deb" || isCached(name, localVersion) {
+		return nil
+	}
+
+	st, err := state.Load()
+	if err != nil {
+		return err
+	}
+
+	var files []string
+	if record, ok := st.Get(name); ok && len(record.Files) > 0 {
+		files = record.Files
+	} else {
+		path, err := exec.LookPath(info.Name)
+		if err != nil {
+			return err
+		}
+		if !managed(st, name, path) {
+			logrus.Debugf("not keeping %s for rollback: %s is not managed by jat", name, path)
+			return nil
+		}
+		files = []string{path}
+	}
+
+	return cachePackage(name, info.PackageType, localVersion, "", files)
+}
+
+// filesExist returns true if there are files in the list and every one is present
+func filesExist(files []string) bool {
+	if len(files) == 0 {
+		return false
+	}
+	for _, f := range files {
+		if _, err := os.Stat(f); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func executeTemplate(ctx context.Context, r shell.Runner, commandTemplate string, m Meta) error {
 	var cmd []string
 
 	tmpl, err := template.New("install").Parse(commandTemplate)
@@ -487,31 +716,17 @@ func executeTemplate(commandTemplate string, m Meta) error {
 		return err
 	}
 
-	fmt.Println(cmd)
-	if cmd[0] == "sudo" {
-		return shell.Sudo(cmd[1], cmd[2:]...)
+	if len(cmd) == 0 {
+		return fmt.Errorf("empty command %q", commandTemplate)
 	}
-	return shell.Shell(cmd[0], cmd[1:]...)
-}
-
-func versionMatch(remote, local string) bool {
-	dashIndex := strings.Index(local, "-")
-	if dashIndex >= 0 {
-		local = local[:dashIndex]
+	if plan.DryRun() {
+		plan.Command(cmd[0], cmd[1:]...)
+		return nil
 	}
 
-	r := strings.Split(remote, ".")
-	l := strings.Split(local, ".")
-
-	for i, v := range r {
-		if i >= len(l) {
-			break
-		}
-
-		if v != l[i] {
-			return false
-		}
+	fmt.Println(cmd)
+	if cmd[0] == "sudo" {
+		return r.Sudo(ctx, cmd[1], cmd[2:]...)
 	}
-
-	return true
+	return r.Run(ctx, cmd[0], cmd[1:]...)
 }
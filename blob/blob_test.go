@@ -0,0 +1,265 @@
+package blob
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dooferlad/jat/plan"
+	"github.com/dooferlad/jat/shell"
+	"github.com/dooferlad/jat/state"
+	"github.com/spf13/viper"
+)
+
+const dpkgQuery = `/usr/bin/dpkg-query --showformat={"version":"${Version}","status":"${Status}"} --show`
+
+// sandbox points the state file and cache at a temporary directory and puts a fake "tool"
+// binary on the PATH, returning the binary's path
+func sandbox(t *testing.T) string {
+	dir := t.TempDir()
+	setenv(t, "XDG_STATE_HOME", filepath.Join(dir, "state"))
+	setenv(t, "XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+	setenv(t, "PATH", filepath.Join(dir, "bin"))
+
+	binary := filepath.Join(dir, "bin", "tool")
+	if err := os.MkdirAll(filepath.Dir(binary), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(binary, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return binary
+}
+
+func setenv(t *testing.T, key, value string) {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func record(t *testing.T, r state.Record) {
+	if err := state.Update(func(s *state.State) error {
+		s.Add(r)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetLocalVersion(t *testing.T) {
+	info := BinaryPackage{
+		Name:           "tool",
+		VersionCommand: []string{"--version"},
+		VersionRegex:   `version ([0-9.]+)`,
+	}
+
+	t.Run("binary is asked first", func(t *testing.T) {
+		binary := sandbox(t)
+		record(t, state.Record{Name: "tool", Version: "1.0.0", Files: []string{binary}})
+
+		f := shell.NewFake().On("tool --version", shell.Response{Output: []byte("\x1b[1mtool\x1b[0m version 2.0.1\n")})
+		got, err := getLocalVersion(context.Background(), f, "tool", info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != "2.0.1" {
+			t.Errorf("got %q, want 2.0.1", got)
+		}
+		if want := []string{"tool --version"}; !reflect.DeepEqual(f.CommandLines(), want) {
+			t.Errorf("ran %q, want %q", f.CommandLines(), want)
+		}
+	})
+
+	t.Run("record when binary can't say", func(t *testing.T) {
+		binary := sandbox(t)
+		record(t, state.Record{Name: "tool", Version: "1.0.0", Files: []string{binary}})
+
+		f := shell.NewFake().On("tool --version", shell.Response{ExitCode: 1})
+		got, err := getLocalVersion(context.Background(), f, "tool", info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != "1.0.0" {
+			t.Errorf("got %q, want 1.0.0", got)
+		}
+	})
+
+	t.Run("removed since it was recorded", func(t *testing.T) {
+		binary := sandbox(t)
+		record(t, state.Record{Name: "tool", Version: "1.0.0", Files: []string{binary}})
+		os.Remove(binary)
+
+		if got, err := getLocalVersion(context.Background(), shell.NewFake(), "tool", info); err == nil {
+			t.Errorf("got %q, want an error", got)
+		}
+	})
+
+	t.Run("deb", func(t *testing.T) {
+		sandbox(t)
+		deb := BinaryPackage{Name: "tool", PackageType: "deb"}
+
+		f := shell.NewFake().On(dpkgQuery+" tool", shell.Response{Output: []byte(`{"version":"1:2.3-1","status":"install ok installed"}`)})
+		got, err := getLocalVersion(context.Background(), f, "tool", deb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != "1:2.3-1" {
+			t.Errorf("got %q, want 1:2.3-1", got)
+		}
+		if want := []string{dpkgQuery + " tool"}; !reflect.DeepEqual(f.CommandLines(), want) {
+			t.Errorf("ran %q, want %q", f.CommandLines(), want)
+		}
+	})
+}
+
+func TestInstallDebRemovedByApt(t *testing.T) {
+	sandbox(t)
+	record(t, state.Record{Name: "tool", Version: "1.0", PackageType: "deb"})
+
+	// Still installed: refuse
+	f := shell.NewFake().On(dpkgQuery+" tool", shell.Response{Output: []byte(`{"version":"1.0","status":"install ok installed"}`)})
+	err := installBinary(context.Background(), f, "tool", BinaryPackage{PackageType: "deb"})
+	if err == nil || !strings.Contains(err.Error(), "already installed") {
+		t.Errorf("got %v, want already installed", err)
+	}
+
+	// Removed with apt: don't claim it is installed
+	f = shell.NewFake().On(dpkgQuery+" tool", shell.Response{Output: []byte(`{"version":"","status":"deinstall ok config-files"}`)})
+	err = installBinary(context.Background(), f, "tool", BinaryPackage{PackageType: "deb"})
+	if err != nil && strings.Contains(err.Error(), "already installed") {
+		t.Errorf("got %v for a removed deb", err)
+	}
+}
+
+func TestUninstallDeb(t *testing.T) {
+	sandbox(t)
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("binary_blobs", map[string]interface{}{
+		"tool": map[string]interface{}{"package_type": "deb"},
+	})
+	record(t, state.Record{Name: "tool", Version: "1.0", PackageType: "deb"})
+
+	f := shell.NewFake().On(dpkgQuery+" tool", shell.Response{Output: []byte(`{"version":"1.0","status":"install ok installed"}`)})
+	if err := Uninstall(context.Background(), f, "tool"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{dpkgQuery + " tool", "sudo dpkg -r tool"}
+	if !reflect.DeepEqual(f.CommandLines(), want) {
+		t.Errorf("ran %q, want %q", f.CommandLines(), want)
+	}
+	if calls := f.Calls(); !calls[1].Root {
+		t.Error("dpkg -r wasn't run as root")
+	}
+
+	st, err := state.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := st.Get("tool"); ok {
+		t.Error("tool is still recorded as installed")
+	}
+}
+
+func TestFilesExist(t *testing.T) {
+	binary := sandbox(t)
+
+	if filesExist(nil) {
+		t.Error("an empty list of files exists")
+	}
+	if !filesExist([]string{binary}) {
+		t.Errorf("%s doesn't exist", binary)
+	}
+	if filesExist([]string{binary, binary + ".missing"}) {
+		t.Error("a missing file exists")
+	}
+}
+
+func TestInstallDryRun(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("1.2.3\n"))
+	}))
+	defer server.Close()
+
+	usr, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	downloaded := filepath.Join(os.TempDir(), "jat", "tool")
+	url := "https://example.com/tool-1.2.3.tar.gz"
+
+	tests := []struct {
+		name string
+		info BinaryPackage
+		want []plan.Step
+	}{
+		{
+			name: "deb",
+			info: BinaryPackage{PackageType: "deb"},
+			want: []plan.Step{
+				{Type: "command", Command: []string{"sudo", "dpkg", "-i", downloaded}},
+			},
+		},
+		{
+			name: "install commands",
+			info: BinaryPackage{
+				InstallPreCommand: "mkdir -p /opt/tool",
+				InstallCommands:   []string{"sudo tar -C /opt/tool -xf {{ .DownloadedFile }}"},
+			},
+			want: []plan.Step{
+				{Type: "command", Command: []string{"mkdir", "-p", "/opt/tool"}},
+				{Type: "command", Command: []string{"sudo", "tar", "-C", "/opt/tool", "-xf", downloaded}},
+			},
+		},
+		{
+			name: "extracted",
+			info: BinaryPackage{},
+			want: []plan.Step{
+				{Type: "extract", Package: "tool", URL: url, Member: "tool", Files: []string{filepath.Join(usr.HomeDir, "bin", "tool")}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sandbox(t)
+			planned := dryRun(t)
+
+			tt.info.VersionURL = server.URL
+			tt.info.DownloadURL = "https://example.com/tool-{{ .Version }}.tar.gz"
+
+			f := shell.NewFake()
+			if err := installBinary(context.Background(), f, "tool", tt.info); err != nil {
+				t.Fatal(err)
+			}
+
+			install := plan.Step{Type: "install", Package: "tool", URL: url, RemoteVersion: "1.2.3"}
+			want := append([]plan.Step{install}, tt.want...)
+			if got := planned(); !reflect.DeepEqual(got, want) {
+				t.Errorf("planned %+v, want %+v", got, want)
+			}
+			if len(f.Calls()) != 0 {
+				t.Errorf("ran %q in a dry run", f.CommandLines())
+			}
+			if st, err := state.Load(); err != nil {
+				t.Fatal(err)
+			} else if _, ok := st.Get("tool"); ok {
+				t.Error("tool was recorded as installed in a dry run")
+			}
+		})
+	}
+}
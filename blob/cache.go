@@ -0,0 +1,302 @@
+package blob
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dooferlad/jat/plan"
+	"github.com/dooferlad/jat/shell"
+	"github.com/dooferlad/jat/state"
+	"github.com/dooferlad/jat/utils"
+	"github.com/dooferlad/jat/version"
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+// cacheVersions is how many installed versions of each package are kept for rollback
+const cacheVersions = 3
+
+// cacheEntry is the manifest stored alongside each cached version
+type cacheEntry struct {
+	Version     string
+	PackageType string
+	Checksum    string
+	// Files maps the name of each file in the cache directory to where it was installed
+	Files map[string]string
+}
+
+// cacheDir returns the directory holding cached versions of name
+func cacheDir(name string) (string, error) {
+	if !safeName(name) {
+		return "", fmt.Errorf("invalid package name %q", name)
+	}
+
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "jat", "blobs", name), nil
+}
+
+// versionDir returns the directory holding version ver of name
+func versionDir(name, ver string) (string, error) {
+	if !safeName(ver) {
+		return "", fmt.Errorf("invalid version %q of %s", ver, name)
+	}
+
+	dir, err := cacheDir(name)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, ver), nil
+}
+
+// safeName returns true if s can be used as a single path element. Versions are scraped
+// from web pages or typed in by hand, so they can't be trusted not to climb out of the
+// cache.
+func safeName(s string) bool {
+	return s != "" && s != "." && !strings.Contains(s, "..") && !strings.ContainsAny(s, `/\`)
+}
+
+// managed returns true if path is somewhere jat installs files: a file it has recorded
+// installing for name, or anything in ~/bin
+func managed(st *state.State, name, path string) bool {
+	for _, record := range st.History {
+		if record.Name == name && utils.InList(path, record.Files) {
+			return true
+		}
+	}
+
+	home, err := homedir.Dir()
+	if err != nil {
+		return false
+	}
+	return filepath.Dir(path) == filepath.Join(home, "bin")
+}
+
+// cachePackage copies an installed version of a package into the cache. For debs files is
+// the downloaded package; for everything else it is the list of installed files.
+func cachePackage(name, packageType, ver, checksum string, files []string) error {
+	dir, err := versionDir(name, ver)
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	entry := cacheEntry{
+		Version:     ver,
+		PackageType: packageType,
+		Checksum:    checksum,
+		Files:       map[string]string{},
+	}
+
+	for i, f := range files {
+		cached := strconv.Itoa(i) + "-" + filepath.Base(f)
+		if err := utils.CopyFile(f, filepath.Join(dir, cached)); err != nil {
+			return err
+		}
+		entry.Files[cached] = f
+	}
+
+	b, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "manifest.json"), b, 0644); err != nil {
+		return err
+	}
+
+	return pruneCache(name, cacheVersions)
+}
+
+// isCached returns true if ver of name is in the cache
+func isCached(name, ver string) bool {
+	dir, err := versionDir(name, ver)
+	if err != nil {
+		return false
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "manifest.json"))
+	return err == nil
+}
+
+// CachedVersions lists the versions of name available to roll back to, oldest first
+func CachedVersions(name string) ([]string, error) {
+	dir, err := cacheDir(name)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var versions []string
+	for _, e := range entries {
+		if e.IsDir() && isCached(name, e.Name()) {
+			versions = append(versions, e.Name())
+		}
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		c, err := version.CompareStrings(versions[i], versions[j])
+		if err != nil {
+			return versions[i] < versions[j]
+		}
+		return c < 0
+	})
+
+	return versions, nil
+}
+
+func pruneCache(name string, keep int) error {
+	versions, err := CachedVersions(name)
+	if err != nil {
+		return err
+	}
+
+	dir, err := cacheDir(name)
+	if err != nil {
+		return err
+	}
+
+	for len(versions) > keep {
+		if err := os.RemoveAll(filepath.Join(dir, versions[0])); err != nil {
+			return err
+		}
+		versions = versions[1:]
+	}
+
+	return nil
+}
+
+// Rollback reinstalls a cached version of a package. If ver is empty the newest cached
+// version older than the one currently installed is used.
+func Rollback(ctx context.Context, r shell.Runner, name, ver string) error {
+	st, err := state.Load()
+	if err != nil {
+		return err
+	}
+	current, _ := st.Get(name)
+
+	if ver == "" {
+		versions, err := CachedVersions(name)
+		if err != nil {
+			return err
+		}
+
+		for _, v := range versions {
+			if current.Version != "" {
+				if c, err := version.CompareStrings(v, current.Version); err != nil || c >= 0 {
+					continue
+				}
+			}
+			ver = v
+		}
+
+		if ver == "" {
+			return fmt.Errorf("no cached version of %s older than %s", name, current.Version)
+		}
+	}
+
+	dir, err := versionDir(name, ver)
+	if err != nil {
+		return err
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("version %s of %s is not cached", ver, name)
+		}
+		return err
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return err
+	}
+
+	if entry.PackageType != "deb" {
+		for _, dest := range entry.Files {
+			if !managed(st, name, dest) {
+				return fmt.Errorf("refusing to roll back %s: %s was not installed by jat", name, dest)
+			}
+		}
+	}
+
+	fmt.Printf("rolling back %s from %s to %s\n", name, current.Version, ver)
+	if plan.DryRun() {
+		step := plan.Step{
+			Type:          "rollback",
+			Package:       name,
+			LocalVersion:  current.Version,
+			RemoteVersion: ver,
+		}
+		for _, dest := range entry.Files {
+			step.Files = append(step.Files, dest)
+		}
+		plan.Add(step)
+		return nil
+	}
+
+	record := state.Record{
+		Name:        name,
+		Action:      "rollback",
+		Version:     entry.Version,
+		PackageType: entry.PackageType,
+		Checksum:    entry.Checksum,
+	}
+
+	for cached, dest := range entry.Files {
+		if entry.PackageType == "deb" {
+			if err := r.Sudo(ctx, "dpkg", "-i", filepath.Join(dir, cached)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Copy next to the destination then rename, so a running binary isn't rewritten in place
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		tmp := dest + ".jat-rollback"
+		if err := utils.CopyFile(filepath.Join(dir, cached), tmp); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, dest); err != nil {
+			return err
+		}
+		record.Files = append(record.Files, dest)
+	}
+	sort.Strings(record.Files)
+
+	return state.Update(func(s *state.State) error {
+		if entry.PackageType != "deb" {
+			if err := removeStale(current.Files, record.Files); err != nil {
+				return err
+			}
+		}
+		s.Add(record)
+		return nil
+	})
+}
@@ -0,0 +1,179 @@
+package blob
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dooferlad/jat/shell"
+	"github.com/dooferlad/jat/state"
+)
+
+func TestVersionDirRejectsTraversal(t *testing.T) {
+	tests := []struct {
+		name, ver string
+		ok        bool
+	}{
+		{"helm", "3.7.2", true},
+		{"helm", "v3.7.2-rc.1", true},
+		{"helm", "..", false},
+		{"helm", "../../.ssh", false},
+		{"helm", "1.0/../../x", false},
+		{"helm", "/etc", false},
+		{"helm", "", false},
+		{"..", "1.0", false},
+		{"a/b", "1.0", false},
+	}
+
+	for _, tt := range tests {
+		dir, err := versionDir(tt.name, tt.ver)
+		if tt.ok {
+			if err != nil {
+				t.Errorf("versionDir(%q, %q): %s", tt.name, tt.ver, err)
+			} else if !strings.HasSuffix(dir, "/jat/blobs/"+tt.name+"/"+tt.ver) {
+				t.Errorf("versionDir(%q, %q) = %s", tt.name, tt.ver, dir)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("versionDir(%q, %q) = %s, want an error", tt.name, tt.ver, dir)
+		}
+	}
+}
+
+// cacheVersion caches a version of tool whose installed file at binary contains its version
+func cacheVersion(t *testing.T, binary, ver string) {
+	if err := ioutil.WriteFile(binary, []byte(ver), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := cachePackage("tool", "", ver, "sum-"+ver, []string{binary}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheKeepsNewest(t *testing.T) {
+	binary := sandbox(t)
+
+	for _, ver := range []string{"1.10", "1.2", "2.0", "1.9"} {
+		cacheVersion(t, binary, ver)
+	}
+
+	got, err := CachedVersions("tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1.9", "1.10", "2.0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCacheManifest(t *testing.T) {
+	binary := sandbox(t)
+	cacheVersion(t, binary, "1.2")
+
+	dir, err := versionDir("tool", "1.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got cacheEntry
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := cacheEntry{Version: "1.2", Checksum: "sum-1.2", Files: map[string]string{"0-tool": binary}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if cached, err := ioutil.ReadFile(filepath.Join(dir, "0-tool")); err != nil || string(cached) != "1.2" {
+		t.Errorf("got cached file %q, %v", cached, err)
+	}
+}
+
+func TestRollbackPicksNewestOlder(t *testing.T) {
+	binary := sandbox(t)
+	for _, ver := range []string{"1.0", "1.5", "3.0"} {
+		cacheVersion(t, binary, ver)
+	}
+	if err := ioutil.WriteFile(binary, []byte("2.0"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	record(t, state.Record{Name: "tool", Version: "2.0", Files: []string{binary}})
+
+	f := shell.NewFake()
+	if err := Rollback(context.Background(), f, "tool", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := ioutil.ReadFile(binary); err != nil || string(got) != "1.5" {
+		t.Errorf("got %q, %v installed, want 1.5", got, err)
+	}
+	st, err := state.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := st.Get("tool"); got.Version != "1.5" || got.Action != "rollback" || !reflect.DeepEqual(got.Files, []string{binary}) {
+		t.Errorf("got record %+v, want a rollback to 1.5", got)
+	}
+	if len(f.Calls()) != 0 {
+		t.Errorf("ran %q rolling back a binary", f.CommandLines())
+	}
+
+	// Nothing is older than 1.0
+	record(t, state.Record{Name: "tool", Version: "1.0", Files: []string{binary}})
+	if err := Rollback(context.Background(), f, "tool", ""); err == nil {
+		t.Error("rolled back with no older version cached")
+	}
+}
+
+func TestRollbackDeb(t *testing.T) {
+	sandbox(t)
+	deb := filepath.Join(t.TempDir(), "tool_1.0_amd64.deb")
+	if err := ioutil.WriteFile(deb, []byte("deb"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cachePackage("tool", "deb", "1.0", "", []string{deb}); err != nil {
+		t.Fatal(err)
+	}
+	record(t, state.Record{Name: "tool", Version: "2.0", PackageType: "deb"})
+
+	f := shell.NewFake()
+	if err := Rollback(context.Background(), f, "tool", "1.0"); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := versionDir("tool", "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"sudo dpkg -i " + filepath.Join(dir, "0-tool_1.0_amd64.deb")}
+	if !reflect.DeepEqual(f.CommandLines(), want) {
+		t.Errorf("ran %q, want %q", f.CommandLines(), want)
+	}
+
+	st, err := state.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := st.Get("tool"); got.Version != "1.0" || got.PackageType != "deb" {
+		t.Errorf("got record %+v, want deb 1.0", got)
+	}
+}
+
+func TestRollbackRefusesUnmanagedFiles(t *testing.T) {
+	sandbox(t)
+	elsewhere := filepath.Join(t.TempDir(), "tool")
+	cacheVersion(t, elsewhere, "1.0")
+	record(t, state.Record{Name: "tool", Version: "2.0"})
+
+	if err := Rollback(context.Background(), shell.NewFake(), "tool", "1.0"); err == nil {
+		t.Errorf("rolled back over %s, which jat never installed", elsewhere)
+	}
+}
@@ -0,0 +1,161 @@
+package blob
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/dooferlad/jat/utils"
+)
+
+// downloadFileName returns the last element of a download URL's path, which is the name
+// checksum files list the download under
+func downloadFileName(downloadURL string) string {
+	if u, err := url.Parse(downloadURL); err == nil {
+		return path.Base(u.Path)
+	}
+	return path.Base(downloadURL)
+}
+
+// verifyChecksum checks the downloaded file against info.Checksum or the checksum file at
+// info.ChecksumURL. Packages with neither aren't checked.
+func verifyChecksum(ctx context.Context, info BinaryPackage, m Meta) error {
+	expected := info.Checksum
+
+	if expected == "" && info.ChecksumURL != "" {
+		tmpl, err := template.New("checksumURL").Parse(info.ChecksumURL)
+		if err != nil {
+			return err
+		}
+
+		var bb bytes.Buffer
+		if err := tmpl.Execute(&bb, m); err != nil {
+			return err
+		}
+
+		sums, err := utils.Get(ctx, bb.String())
+		if err != nil {
+			return err
+		}
+
+		expected, err = findChecksum(sums, m.FileName)
+		if err != nil {
+			return fmt.Errorf("checksum for %s: %s", m.Name, err)
+		}
+	}
+
+	if expected == "" {
+		return nil
+	}
+
+	h, expected, err := digest(expected)
+	if err != nil {
+		return fmt.Errorf("checksum for %s: %s", m.Name, err)
+	}
+
+	f, err := os.Open(m.DownloadedFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+
+	if actual := hex.EncodeToString(h.Sum(nil)); actual != expected {
+		return fmt.Errorf("checksum mismatch for %s (%s): expected %s, got %s", m.Name, m.DownloadURL, expected, actual)
+	}
+
+	return nil
+}
+
+// digest returns the hash to check a checksum with and the hex digest to compare against.
+// "sha256:<hex>" and "sha512:<hex>" name the algorithm; a bare digest is told apart by its
+// length.
+func digest(checksum string) (hash.Hash, string, error) {
+	algorithm := ""
+	checksum = strings.ToLower(strings.TrimSpace(checksum))
+	if i := strings.Index(checksum, ":"); i >= 0 {
+		algorithm, checksum = checksum[:i], checksum[i+1:]
+	}
+
+	if algorithm == "" {
+		switch len(checksum) {
+		case sha256.Size * 2:
+			algorithm = "sha256"
+		case sha512.Size * 2:
+			algorithm = "sha512"
+		default:
+			return nil, "", fmt.Errorf("unsupported digest %q", checksum)
+		}
+	}
+
+	var h hash.Hash
+	switch algorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, "", fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+
+	if len(checksum) != h.Size()*2 {
+		return nil, "", fmt.Errorf("%s digest %q is the wrong length", algorithm, checksum)
+	}
+	if _, err := hex.DecodeString(checksum); err != nil {
+		return nil, "", fmt.Errorf("%s digest %q is not hex", algorithm, checksum)
+	}
+
+	return h, checksum, nil
+}
+
+// findChecksum looks up fileName in the contents of a checksum file. Both the
+// "<digest>  <file>" lines of SHA256SUMS and checksums.txt, and single digest
+// .sha256 files are understood.
+func findChecksum(sums []byte, fileName string) (string, error) {
+	var only string
+	lines := 0
+
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		lines++
+
+		if len(fields) < 2 {
+			only = fields[0]
+			continue
+		}
+
+		// sha256sum marks binary mode files with a leading '*'
+		name := strings.TrimPrefix(fields[len(fields)-1], "*")
+		if path.Base(name) == fileName {
+			return fields[0], nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	if lines == 1 && only != "" {
+		return only, nil
+	}
+
+	return "", fmt.Errorf("%s not found in checksum file", fileName)
+}
@@ -0,0 +1,86 @@
+package blob
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDigest(t *testing.T) {
+	sha256Hex := strings.Repeat("ab", 32)
+	sha512Hex := strings.Repeat("cd", 64)
+
+	tests := []struct {
+		checksum string
+		size     int
+		wantErr  bool
+	}{
+		{checksum: sha256Hex, size: 32},
+		{checksum: sha512Hex, size: 64},
+		{checksum: "sha256:" + sha256Hex, size: 32},
+		{checksum: "SHA512:" + strings.ToUpper(sha512Hex), size: 64},
+		{checksum: "sha512:" + sha256Hex, wantErr: true},
+		{checksum: "sha256:" + sha512Hex, wantErr: true},
+		{checksum: "md5:" + strings.Repeat("ab", 16), wantErr: true},
+		{checksum: strings.Repeat("ab", 20), wantErr: true},
+		{checksum: strings.Repeat("zz", 32), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		h, hexDigest, err := digest(tt.checksum)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("digest(%q) succeeded, want an error", tt.checksum)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("digest(%q): %s", tt.checksum, err)
+			continue
+		}
+		if h.Size() != tt.size {
+			t.Errorf("digest(%q) picked a %d byte hash, want %d", tt.checksum, h.Size(), tt.size)
+		}
+		if strings.Contains(hexDigest, ":") || hexDigest != strings.ToLower(hexDigest) {
+			t.Errorf("digest(%q) returned %q", tt.checksum, hexDigest)
+		}
+	}
+}
+
+func TestFindChecksum(t *testing.T) {
+	a := strings.Repeat("a", 64)
+	b := strings.Repeat("b", 64)
+
+	tests := []struct {
+		name     string
+		sums     string
+		fileName string
+		want     string
+		wantErr  bool
+	}{
+		{name: "sha256sum", sums: a + "  tool_linux_amd64.tar.gz\n" + b + "  tool_darwin_amd64.tar.gz\n", fileName: "tool_darwin_amd64.tar.gz", want: b},
+		{name: "binary mode", sums: a + " *tool_linux_amd64.tar.gz\n", fileName: "tool_linux_amd64.tar.gz", want: a},
+		{name: "path in sums", sums: a + "  dist/tool_linux_amd64.tar.gz\n", fileName: "tool_linux_amd64.tar.gz", want: a},
+		{name: "comments", sums: "# sha256\n\n" + a + "  tool\n", fileName: "tool", want: a},
+		{name: "single digest", sums: a + "\n", fileName: "tool", want: a},
+		{name: "missing", sums: a + "  other\n", fileName: "tool", wantErr: true},
+		{name: "digest for another file", sums: b + "\n" + a + "  other\n", fileName: "tool", wantErr: true},
+		{name: "prefix match", sums: a + "  tool.sig\n", fileName: "tool", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := findChecksum([]byte(tt.sums), tt.fileName)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: found %q, want an error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: found %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
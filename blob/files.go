@@ -0,0 +1,132 @@
+package blob
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dooferlad/jat/archive"
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+// FileMapping installs members of a release archive that match From into To. To is either
+// a directory or one of the well known destinations in destinations.
+type FileMapping struct {
+	From string
+	To   string
+	// Name renames the installed file, useful for completion scripts that are named
+	// after the shell rather than the command
+	Name string
+}
+
+// destinations maps the names that can be used in FileMapping.To to directories under
+// the home directory. Man pages are further sorted into sections.
+var destinations = map[string]string{
+	"bin":             "bin",
+	"man":             ".local/share/man",
+	"bash-completion": ".local/share/bash-completion/completions",
+	"zsh-completion":  ".local/share/zsh/site-functions",
+	"fish-completion": ".config/fish/completions",
+	"applications":    ".local/share/applications",
+}
+
+// mappings turns the members and files of a package into instructions for archive.Extract
+func mappings(info BinaryPackage, m Meta) ([]archive.Mapping, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	members := info.Members
+	if len(members) == 0 {
+		members = []string{m.Name}
+	}
+
+	var result []archive.Mapping
+	for _, member := range members {
+		result = append(result, archive.Mapping{
+			Pattern:  member,
+			Target:   intoDir(m.HomeBinPath, ""),
+			Mode:     0755,
+			Required: true,
+		})
+	}
+
+	for _, f := range info.Files {
+		mapping := archive.Mapping{
+			Pattern: f.From,
+			Mode:    0644,
+		}
+
+		switch f.To {
+		case "bin":
+			mapping.Target = intoDir(m.HomeBinPath, f.Name)
+			mapping.Mode = 0755
+		case "man":
+			mapping.Target = manPage(filepath.Join(home, destinations["man"]), f.Name)
+		default:
+			if dir, ok := destinations[f.To]; ok {
+				mapping.Target = intoDir(filepath.Join(home, dir), f.Name)
+			} else {
+				dir, err := homedir.Expand(f.To)
+				if err != nil {
+					return nil, err
+				}
+				mapping.Target = intoDir(dir, f.Name)
+			}
+		}
+
+		result = append(result, mapping)
+	}
+
+	return result, nil
+}
+
+// intoDir returns a target function that puts members into dir, renamed to name if set
+func intoDir(dir, name string) func(string) string {
+	return func(member string) string {
+		if name != "" {
+			return filepath.Join(dir, name)
+		}
+		return filepath.Join(dir, path.Base(member))
+	}
+}
+
+// manPage returns a target function that puts man pages into the section directory given
+// by their extension, so helm.1 or helm.1.gz ends up in man1
+func manPage(dir, name string) func(string) string {
+	return func(member string) string {
+		base := path.Base(member)
+		if name != "" {
+			base = name
+		}
+
+		section := "1"
+		ext := strings.TrimPrefix(path.Ext(strings.TrimSuffix(base, ".gz")), ".")
+		if ext != "" && ext[0] >= '1' && ext[0] <= '9' {
+			section = ext[:1]
+		}
+
+		return filepath.Join(dir, "man"+section, base)
+	}
+}
+
+// removeStale deletes files a previous install wrote that the new one didn't
+func removeStale(previous, current []string) error {
+	keep := map[string]bool{}
+	for _, f := range current {
+		keep[f] = true
+	}
+
+	for _, f := range previous {
+		if keep[f] {
+			continue
+		}
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/dooferlad/jat/utils"
+	"github.com/dooferlad/jat/verify"
+)
+
+// Verification describes the detached signature published next to a package
+type Verification struct {
+	// Type is one of gpg, minisign or cosign
+	Type string
+	// Signature is a template for the signature URL, or just its name if it sits next to
+	// the download, as GitHub release assets do. It defaults to {{ .FileName }}.sig
+	// ({{ .FileName }}.minisig for minisign).
+	Signature string
+	// Key is the trusted public key. Relative paths are found in the jat config directory.
+	Key string
+}
+
+// KeyDir returns where relative public key paths are looked up
+func KeyDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "jat", "keys"), nil
+}
+
+// verifySignature fetches the signature for the downloaded file and checks it against the
+// configured key. Packages without a verify block aren't checked.
+func verifySignature(ctx context.Context, info BinaryPackage, m Meta) error {
+	v := info.Verify
+	if v == nil {
+		return nil
+	}
+
+	if v.Key == "" {
+		return fmt.Errorf("no key given to verify %s", m.Name)
+	}
+
+	signatureTemplate := v.Signature
+	if signatureTemplate == "" {
+		signatureTemplate = "{{ .FileName }}.sig"
+		if v.Type == "minisign" {
+			signatureTemplate = "{{ .FileName }}.minisig"
+		}
+	}
+
+	tmpl, err := template.New("signature").Parse(signatureTemplate)
+	if err != nil {
+		return err
+	}
+
+	var bb bytes.Buffer
+	if err := tmpl.Execute(&bb, m); err != nil {
+		return err
+	}
+
+	signatureURL := bb.String()
+	if !strings.Contains(signatureURL, "://") {
+		signatureURL = strings.TrimSuffix(m.DownloadURL, path.Base(m.DownloadURL)) + signatureURL
+	}
+
+	signature, err := utils.Get(ctx, signatureURL)
+	if err != nil {
+		return err
+	}
+
+	keyFile := v.Key
+	if !filepath.IsAbs(keyFile) {
+		dir, err := KeyDir()
+		if err != nil {
+			return err
+		}
+		keyFile = filepath.Join(dir, keyFile)
+	}
+
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(m.DownloadedFile)
+	if err != nil {
+		return err
+	}
+
+	if err := verify.Detached(v.Type, data, signature, key); err != nil {
+		return fmt.Errorf("signature check failed for %s (%s): %s", m.Name, signatureURL, err)
+	}
+
+	fmt.Printf("%s: %s signature verified\n", m.Name, v.Type)
+
+	return nil
+}
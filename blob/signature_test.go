@@ -0,0 +1,80 @@
+package blob
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifySignature(t *testing.T) {
+	dir := t.TempDir()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "cosign.pub")
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	artifact := []byte("binary")
+	downloaded := filepath.Join(dir, "tool")
+	if err := ioutil.WriteFile(downloaded, artifact, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/good/tool.sig":
+			w.Write([]byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, artifact))))
+		case "/bad/tool.sig":
+			w.Write([]byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte("other")))))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		dir     string
+		wantErr bool
+	}{
+		{name: "good signature", dir: "good"},
+		{name: "bad signature", dir: "bad", wantErr: true},
+		{name: "missing signature", dir: "missing", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := BinaryPackage{Verify: &Verification{Type: "cosign", Key: keyFile}}
+			m := Meta{
+				Name:           "tool",
+				DownloadURL:    srv.URL + "/" + tt.dir + "/tool",
+				DownloadedFile: downloaded,
+				FileName:       "tool",
+			}
+
+			err := verifySignature(context.Background(), info, m)
+			if tt.wantErr && err == nil {
+				t.Error("verified, want an error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
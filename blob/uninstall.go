@@ -0,0 +1,100 @@
+package blob
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/dooferlad/jat/dpkg"
+	"github.com/dooferlad/jat/plan"
+	"github.com/dooferlad/jat/shell"
+	"github.com/dooferlad/jat/state"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/spf13/viper"
+)
+
+// Uninstall removes a package installed by jat, or a deb or ~/bin binary listed in the
+// config. In a dry run it only prints what would be removed.
+func Uninstall(ctx context.Context, r shell.Runner, packageName string) error {
+	var config Config
+	err := viper.Unmarshal(&config)
+	if err != nil {
+		return err
+	}
+
+	st, err := state.Load()
+	if err != nil {
+		return err
+	}
+
+	record, recorded := st.Get(packageName)
+	info, configured := config.BinaryBlobs[packageName]
+	if !recorded && !configured {
+		return fmt.Errorf("%s is not installed by jat or listed in the config", packageName)
+	}
+
+	if info.Name == "" {
+		info.Name = packageName
+	}
+	if info.PackageType == "" {
+		info.PackageType = record.PackageType
+	}
+
+	if info.PackageType == "deb" {
+		if status, err := dpkg.Query(ctx, r, info.Name); err != nil || status.Status != "install ok installed" {
+			return fmt.Errorf("%s is not installed", info.Name)
+		}
+
+		if err := r.Sudo(ctx, "dpkg", "-r", info.Name); err != nil {
+			return err
+		}
+	} else {
+		files := record.Files
+		if len(files) == 0 {
+			// Not installed by jat, so only remove it if it is in ~/bin
+			binary, err := exec.LookPath(info.Name)
+			if err != nil {
+				return fmt.Errorf("%s is not installed", info.Name)
+			}
+
+			home, err := homedir.Dir()
+			if err != nil {
+				return err
+			}
+			if filepath.Dir(binary) != filepath.Join(home, "bin") {
+				return fmt.Errorf("%s was not installed by jat, not removing it", binary)
+			}
+			files = []string{binary}
+		}
+
+		if plan.DryRun() {
+			plan.Add(plan.Step{
+				Type:         "uninstall",
+				Package:      packageName,
+				LocalVersion: record.Version,
+				Files:        files,
+			})
+			fmt.Printf("[dry-run] remove %s\n", strings.Join(files, " "))
+			return nil
+		}
+
+		for _, f := range files {
+			fmt.Println("removing", f)
+			if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	if plan.DryRun() {
+		return nil
+	}
+
+	return state.Update(func(s *state.State) error {
+		s.Remove(packageName)
+		return nil
+	})
+}
@@ -0,0 +1,147 @@
+package blob
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dooferlad/jat/plan"
+	"github.com/dooferlad/jat/shell"
+	"github.com/dooferlad/jat/state"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/spf13/viper"
+)
+
+// configure lists tool in the config as a binary blob
+func configure(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("binary_blobs", map[string]interface{}{
+		"tool": map[string]interface{}{"name": "tool"},
+	})
+}
+
+// dryRun turns on dry run mode for the rest of the test, returning a function that lists
+// the steps planned since
+func dryRun(t *testing.T) func() []plan.Step {
+	plan.SetDryRun(true)
+	t.Cleanup(func() { plan.SetDryRun(false) })
+
+	before := len(plan.Steps())
+	return func() []plan.Step {
+		return plan.Steps()[before:]
+	}
+}
+
+// home points ~ at dir
+func home(t *testing.T, dir string) {
+	setenv(t, "HOME", dir)
+	homedir.DisableCache = true
+	t.Cleanup(func() { homedir.DisableCache = false })
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestUninstallRecordedFiles(t *testing.T) {
+	binary := sandbox(t)
+	completion := filepath.Join(filepath.Dir(binary), "tool.bash")
+	if err := ioutil.WriteFile(completion, []byte("complete -F _tool tool\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	record(t, state.Record{Name: "tool", Version: "1.0", Files: []string{binary, completion}})
+
+	f := shell.NewFake()
+	if err := Uninstall(context.Background(), f, "tool"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{binary, completion} {
+		if exists(file) {
+			t.Errorf("%s wasn't removed", file)
+		}
+	}
+	if len(f.Calls()) != 0 {
+		t.Errorf("ran %q removing files", f.CommandLines())
+	}
+
+	st, err := state.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := st.Get("tool"); ok {
+		t.Error("tool is still recorded as installed")
+	}
+}
+
+func TestUninstallHomeBin(t *testing.T) {
+	t.Run("in ~/bin", func(t *testing.T) {
+		binary := sandbox(t)
+		configure(t)
+		home(t, filepath.Dir(filepath.Dir(binary)))
+
+		if err := Uninstall(context.Background(), shell.NewFake(), "tool"); err != nil {
+			t.Fatal(err)
+		}
+		if exists(binary) {
+			t.Errorf("%s wasn't removed", binary)
+		}
+	})
+
+	t.Run("elsewhere", func(t *testing.T) {
+		binary := sandbox(t)
+		configure(t)
+		home(t, t.TempDir())
+
+		if err := Uninstall(context.Background(), shell.NewFake(), "tool"); err == nil {
+			t.Error("removed a binary jat didn't install from outside ~/bin")
+		}
+		if !exists(binary) {
+			t.Errorf("%s was removed", binary)
+		}
+	})
+
+	t.Run("neither recorded nor configured", func(t *testing.T) {
+		binary := sandbox(t)
+		viper.Reset()
+		home(t, filepath.Dir(filepath.Dir(binary)))
+
+		if err := Uninstall(context.Background(), shell.NewFake(), "tool"); err == nil {
+			t.Error("removed a binary that isn't in the config")
+		}
+		if !exists(binary) {
+			t.Errorf("%s was removed", binary)
+		}
+	})
+}
+
+func TestUninstallDryRun(t *testing.T) {
+	binary := sandbox(t)
+	record(t, state.Record{Name: "tool", Version: "1.0", Files: []string{binary}})
+	planned := dryRun(t)
+
+	if err := Uninstall(context.Background(), shell.NewFake(), "tool"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !exists(binary) {
+		t.Errorf("%s was removed in a dry run", binary)
+	}
+	st, err := state.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := st.Get("tool"); !ok {
+		t.Error("tool was forgotten in a dry run")
+	}
+
+	want := []plan.Step{{Type: "uninstall", Package: "tool", LocalVersion: "1.0", Files: []string{binary}}}
+	if got := planned(); !reflect.DeepEqual(got, want) {
+		t.Errorf("planned %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,39 @@
+/*
+Copyright © 2020 James Tunnicliffe <dooferlad@nanosheep.org>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// cancelCmd represents the cancel command
+var cancelCmd = &cobra.Command{
+	Use:   "cancel",
+	Short: "Cancel a reboot or shutdown scheduled with --at or --in",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := runner.Sudo(cmd.Context(), "shutdown", "-c", "jat: scheduled reboot or shutdown cancelled"); err != nil {
+			return fmt.Errorf("cancelling: %s", err)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cancelCmd)
+}
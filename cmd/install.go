@@ -25,7 +25,7 @@ var installCmd = &cobra.Command{
 	Short: "install a package using instructions in config file",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := blob.Install(args[0]); err != nil {
+		if err := blob.Install(cmd.Context(), runner, args[0]); err != nil {
 			return err
 		}
 		return nil
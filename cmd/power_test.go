@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dooferlad/jat/shell"
+	"github.com/spf13/viper"
+)
+
+// quietConfig switches off everything Upgrade would do, and the preflight checks that look
+// at the real machine rather than going through the runner
+func quietConfig(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	viper.Set("package_manager", "none")
+	viper.Set("preflight.skip", []string{"package-manager", "zfs", "tmux", "inhibitors"})
+}
+
+func TestReboot(t *testing.T) {
+	f := shell.NewFake()
+	if err := Reboot(context.Background(), f, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reboot(context.Background(), f, "+15"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"sudo reboot",
+		"sudo shutdown -r +15 jat: rebooting after installing updates",
+	}
+	if !reflect.DeepEqual(f.CommandLines(), want) {
+		t.Errorf("ran %q, want %q", f.CommandLines(), want)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	quietConfig(t)
+
+	f := shell.NewFake()
+	if err := Shutdown(context.Background(), f, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"sudo fstrim --all --verbose",
+		"who",
+		"sudo halt -p",
+	}
+	if !reflect.DeepEqual(f.CommandLines(), want) {
+		t.Errorf("ran %q, want %q", f.CommandLines(), want)
+	}
+}
+
+func TestShutdownBlocked(t *testing.T) {
+	quietConfig(t)
+
+	f := shell.NewFake().On("who", shell.Response{Output: []byte("jat-test-other pts/3        2021-12-18 10:00 (192.0.2.1)\n")})
+	err := Shutdown(context.Background(), f, "")
+	if err == nil || !strings.Contains(err.Error(), "jat-test-other is logged in on pts/3") {
+		t.Errorf("got %v, want a blocker for jat-test-other", err)
+	}
+	for _, c := range f.CommandLines() {
+		if strings.Contains(c, "halt") {
+			t.Errorf("ran %s despite a blocker", c)
+		}
+	}
+
+	// --force skips the checks
+	force = true
+	defer func() { force = false }()
+	f = shell.NewFake()
+	if err := Shutdown(context.Background(), f, "+5"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"sudo fstrim --all --verbose",
+		"sudo shutdown -P +5 jat: shutting down after installing updates",
+	}
+	if !reflect.DeepEqual(f.CommandLines(), want) {
+		t.Errorf("ran %q, want %q", f.CommandLines(), want)
+	}
+}
+
+func TestPowerTime(t *testing.T) {
+	defer func() { powerAt, powerIn = "", 0 }()
+
+	tests := []struct {
+		at      string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{want: ""},
+		{at: "03:00", want: "03:00"},
+		{at: "3am", wantErr: true},
+		{in: "15m", want: "+15"},
+		{in: "90s", want: "+2"},
+		{at: "03:00", in: "15m", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		powerAt = tt.at
+		powerIn = 0
+		if tt.in != "" {
+			if err := rebootCmd.Flags().Set("in", tt.in); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got, err := powerTime()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("--at %q --in %q: got %q, want an error", tt.at, tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("--at %q --in %q: %s", tt.at, tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("--at %q --in %q: got %q, want %q", tt.at, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestShutdownReportsFailures(t *testing.T) {
+	quietConfig(t)
+	viper.Set("updaters.flatpak", true)
+
+	f := shell.NewFake().On("flatpak update --noninteractive --assumeyes", shell.Response{ExitCode: 1})
+	err := Shutdown(context.Background(), f, "")
+	if err == nil || err.Error() != "1 of 2 steps failed" {
+		t.Errorf("got %v, want the failed update reported", err)
+	}
+
+	// A failed update doesn't stop the shutdown
+	if got := f.CommandLines(); got[len(got)-1] != "sudo halt -p" {
+		t.Errorf("ran %q, want a shutdown", got)
+	}
+}
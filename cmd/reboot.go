@@ -15,15 +15,101 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"strings"
+	"time"
 
+	"github.com/dooferlad/jat/needrestart"
+	"github.com/dooferlad/jat/preflight"
+	"github.com/dooferlad/jat/report"
 	"github.com/dooferlad/jat/shell"
 
 	"github.com/spf13/cobra"
 )
 
-func Reboot() error {
-	if err := shell.Sudo("reboot"); err != nil {
+var rebootIfRequired bool
+var force bool
+var powerAt string
+var powerIn time.Duration
+
+// scheduleMessage is broadcast to logged in users when a reboot or shutdown is scheduled
+const scheduleMessage = "jat: %s after installing updates"
+
+// powerTime turns --at and --in into a time shutdown understands, or "" to power off now
+func powerTime() (string, error) {
+	if powerAt != "" && powerIn != 0 {
+		return "", fmt.Errorf("--at and --in can't be used together")
+	}
+
+	if powerAt != "" {
+		if _, err := time.Parse("15:04", powerAt); err != nil {
+			return "", fmt.Errorf("--at %s: expected a time like 03:00", powerAt)
+		}
+		return powerAt, nil
+	}
+
+	if powerIn < 0 {
+		return "", fmt.Errorf("--in %s is in the past", powerIn)
+	}
+	if powerIn > 0 {
+		// shutdown only schedules to the minute, so round up rather than go early
+		return fmt.Sprintf("+%d", int(math.Ceil(powerIn.Minutes()))), nil
+	}
+
+	return "", nil
+}
+
+// checkSafe refuses to reboot or shut down while something, like another user being
+// logged in, would be interrupted, unless --force was given
+func checkSafe(ctx context.Context, r shell.Runner, action string) error {
+	if force {
+		return nil
+	}
+
+	return preflight.Run(ctx, r, action)
+}
+
+// RebootRequired reports whether the machine needs a reboot, printing why, or which
+// services need restarting instead if it doesn't
+func RebootRequired(ctx context.Context, r shell.Runner) (bool, error) {
+	reasons, err := needrestart.RebootRequired()
+	if err != nil {
+		return false, err
+	}
+
+	if len(reasons) > 0 {
+		for _, reason := range reasons {
+			fmt.Println("reboot needed:", reason)
+		}
+		return true, nil
+	}
+
+	fmt.Println("no reboot needed")
+
+	procs, err := needrestart.StaleProcesses(ctx, r)
+	if err != nil {
+		return false, err
+	}
+	if units := needrestart.Units(procs); len(units) > 0 {
+		fmt.Printf("services running replaced libraries, which need restarting:\n  %s\n", strings.Join(units, "\n  "))
+	}
+
+	return false, nil
+}
+
+// Reboot reboots the machine, or if when is set, schedules a reboot with shutdown
+func Reboot(ctx context.Context, r shell.Runner, when string) error {
+	if when != "" {
+		if err := r.Sudo(ctx, "shutdown", "-r", when, fmt.Sprintf(scheduleMessage, "rebooting")); err != nil {
+			return fmt.Errorf("scheduling reboot: %s", err)
+		}
+		fmt.Printf("reboot scheduled for %s, run jat cancel to stop it\n", when)
+		return nil
+	}
+
+	if err := r.Sudo(ctx, "reboot"); err != nil {
 		return fmt.Errorf("rebooting: %s", err)
 	}
 
@@ -35,18 +121,47 @@ var rebootCmd = &cobra.Command{
 	Use:   "reboot",
 	Short: "Update software and reboot",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := Upgrade([]string{}); err != nil {
+		when, err := powerTime()
+		if err != nil {
+			return err
+		}
+
+		// Failures updating individual packages are reported, but don't stop the reboot
+		rep := report.New()
+		if err := Upgrade(cmd.Context(), runner, rep, []string{}); err != nil {
+			rep.Write(stdout, output)
+			return err
+		}
+		if err := rep.Write(stdout, output); err != nil {
 			return err
 		}
 
-		if err := Reboot(); err != nil {
+		if rebootIfRequired {
+			if required, err := RebootRequired(cmd.Context(), runner); err != nil {
+				return err
+			} else if !required {
+				return rep.Err()
+			}
+		}
+
+		if err := checkSafe(cmd.Context(), runner, "reboot"); err != nil {
 			return err
 		}
 
-		return nil
+		if err := Reboot(cmd.Context(), runner, when); err != nil {
+			return err
+		}
+
+		return rep.Err()
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(rebootCmd)
+	addOutputFlag(rebootCmd)
+
+	rebootCmd.Flags().BoolVar(&rebootIfRequired, "if-required", false, "only reboot if updates need it")
+	rebootCmd.Flags().StringVar(&powerAt, "at", "", "update now, then reboot at this time (HH:MM)")
+	rebootCmd.Flags().DurationVar(&powerIn, "in", 0, "update now, then reboot after this long (e.g. 15m)")
+	rebootCmd.Flags().BoolVar(&force, "force", false, "reboot even if preflight checks find something that would be interrupted")
 }
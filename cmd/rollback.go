@@ -0,0 +1,60 @@
+/*
+Copyright © 2020 James Tunnicliffe <dooferlad@nanosheep.org>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dooferlad/jat/blob"
+	"github.com/spf13/cobra"
+)
+
+var rollbackList bool
+
+// rollbackCmd represents the rollback command
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback NAME [VERSION]",
+	Short: "reinstall a previous version of a package installed by jat",
+	Long: `Reinstall a previous version of a package installed by jat
+
+jat keeps the last few versions of every package it installs. Without VERSION
+the newest cached version older than the installed one is restored.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if rollbackList {
+			versions, err := blob.CachedVersions(args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Println(strings.Join(versions, "\n"))
+			return nil
+		}
+
+		var ver string
+		if len(args) > 1 {
+			ver = args[1]
+		}
+
+		return blob.Rollback(cmd.Context(), runner, args[0], ver)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rollbackCmd)
+
+	rollbackCmd.Flags().BoolVarP(&rollbackList, "list", "l", false, "list cached versions")
+}
@@ -15,9 +15,16 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/dooferlad/jat/plan"
+	"github.com/dooferlad/jat/report"
+	"github.com/dooferlad/jat/shell"
 	"github.com/sirupsen/logrus"
 
 	homedir "github.com/mitchellh/go-homedir"
@@ -27,6 +34,15 @@ import (
 
 var cfgFile string
 
+// runner runs every external command jat uses
+var runner shell.Runner = shell.NewExec()
+var planFile string
+var output string
+
+// stdout is where a plan or report asked for on standard output is written. Everything
+// else is sent to stderr by reserveStdout so that it can be parsed.
+var stdout = os.Stdout
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "jat",
@@ -40,12 +56,40 @@ var rootCmd = &cobra.Command{
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	// Cancelling the context on Ctrl-C stops downloads and commands in flight, giving
+	// them a chance to clean up after themselves rather than being killed outright
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := rootCmd.ExecuteContext(ctx)
+	cancel()
+
+	if planFile != "" {
+		if perr := writePlan(planFile); perr != nil {
+			fmt.Println(perr)
+			os.Exit(1)
+		}
+	}
+
+	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 }
 
+// writePlan writes the steps of a dry run as JSON to fileName, or stdout if it is "-"
+func writePlan(fileName string) error {
+	if fileName == "-" {
+		return plan.WriteJSON(stdout)
+	}
+
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return plan.WriteJSON(f)
+}
+
 func init() {
 	cobra.OnInitialize(initConfig)
 
@@ -54,10 +98,39 @@ func init() {
 	// will be global for your application.
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.jat.yaml)")
 	rootCmd.PersistentFlags().Bool("verbose", false, "print debug messages")
+	rootCmd.PersistentFlags().BoolP("dry-run", "n", false, "print what would be done without changing anything")
+	rootCmd.PersistentFlags().StringVar(&planFile, "plan", "", "write the dry run plan as JSON to this file (- for stdout)")
+}
+
+// addOutputFlag adds --output to a command that finishes with a report, checking it before
+// the command runs. JSON gets stdout to itself; see initConfig.
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "format of the summary printed after updating: table or json")
+	cmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if err := report.CheckFormat(output); err != nil {
+			return err
+		}
+		if output == "json" && planFile == "-" {
+			return errors.New("--output json and --plan - can't both be written to stdout")
+		}
+		return nil
+	}
+}
+
+// reserveStdout keeps standard output for machine readable output, sending everything
+// else jat and the commands it runs print to stderr
+func reserveStdout() {
+	os.Stdout = os.Stderr
+	logrus.SetOutput(os.Stderr)
 }
 
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
+	// Flags have been parsed by now, so this happens before anything is printed
+	if planFile == "-" || output == "json" {
+		reserveStdout()
+	}
+
 	if cfgFile != "" {
 		// Use config file from the flag.
 		viper.SetConfigFile(cfgFile)
@@ -80,9 +153,16 @@ func initConfig() {
 	if err := viper.ReadInConfig(); err == nil {
 		fmt.Println("Using config file:", viper.ConfigFileUsed())
 	}
-	if v, err := rootCmd.PersistentFlags().GetBool("verbose"); err == nil && v {
+	if v, err := rootCmd.PersistentFlags().GetBool("verbose"); err != nil {
+		logrus.Error(err)
+	} else if v {
 		logrus.SetLevel(logrus.DebugLevel)
-	} else {
+	}
+
+	if d, err := rootCmd.PersistentFlags().GetBool("dry-run"); err != nil {
 		logrus.Error(err)
+	} else {
+		// Asking for a plan implies not doing anything
+		plan.SetDryRun(d || planFile != "")
 	}
 }
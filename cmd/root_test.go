@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/dooferlad/jat/plan"
+	"github.com/spf13/cobra"
+)
+
+// captureStdout points stdout at one pipe and os.Stdout and os.Stderr at another, returning
+// functions that read what was written to each once the test is done writing
+func captureStdout(t *testing.T) (human, machine func() string) {
+	oldStdout, oldReserved := os.Stdout, stdout
+	t.Cleanup(func() { os.Stdout, stdout = oldStdout, oldReserved })
+
+	pipe := func() (*os.File, func() string) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { r.Close() })
+		return w, func() string {
+			w.Close()
+			b, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return string(b)
+		}
+	}
+
+	var stderr *os.File
+	stdout, machine = pipe()
+	stderr, human = pipe()
+	os.Stdout = stdout
+	oldStderr := os.Stderr
+	os.Stderr = stderr
+	t.Cleanup(func() { os.Stderr = oldStderr })
+
+	return human, machine
+}
+
+func TestPlanToStdout(t *testing.T) {
+	human, machine := captureStdout(t)
+	plan.SetDryRun(true)
+	defer plan.SetDryRun(false)
+
+	reserveStdout()
+	fmt.Println("Using config file: /home/me/.jat.yaml")
+	plan.Command("sudo", "apt", "upgrade")
+	if err := writePlan("-"); err != nil {
+		t.Fatal(err)
+	}
+
+	var steps []plan.Step
+	out := machine()
+	if err := json.Unmarshal([]byte(out), &steps); err != nil {
+		t.Fatalf("stdout isn't just the plan: %s\n%s", err, out)
+	}
+	if got := human(); got != "Using config file: /home/me/.jat.yaml\n[dry-run] sudo apt upgrade\n" {
+		t.Errorf("got %q on stderr", got)
+	}
+}
+
+func TestOutputFlag(t *testing.T) {
+	if rootCmd.PersistentFlags().Lookup("output") != nil {
+		t.Error("--output is a flag of every command")
+	}
+	if watchCmd.Flags().Lookup("output") != nil {
+		t.Error("jat watch takes --output")
+	}
+
+	defer func() { output, planFile = "table", "" }()
+	for _, cmd := range []*cobra.Command{updateCmd, rebootCmd, shutdownCmd} {
+		if cmd.Flags().Lookup("output") == nil {
+			t.Errorf("jat %s doesn't take --output", cmd.Name())
+			continue
+		}
+
+		output, planFile = "json", ""
+		if err := cmd.PersistentPreRunE(cmd, nil); err != nil {
+			t.Errorf("jat %s --output json: %s", cmd.Name(), err)
+		}
+
+		output = "yaml"
+		if err := cmd.PersistentPreRunE(cmd, nil); err == nil {
+			t.Errorf("jat %s accepted --output yaml", cmd.Name())
+		}
+
+		output, planFile = "json", "-"
+		if err := cmd.PersistentPreRunE(cmd, nil); err == nil {
+			t.Errorf("jat %s accepted --output json with --plan -", cmd.Name())
+		}
+	}
+}
@@ -15,8 +15,10 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/dooferlad/jat/report"
 	"github.com/dooferlad/jat/shell"
 
 	"github.com/spf13/cobra"
@@ -27,27 +29,62 @@ var shutdownCmd = &cobra.Command{
 	Use:   "shutdown",
 	Short: "trim file systems, update, power off",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return Shutdown()
+		when, err := powerTime()
+		if err != nil {
+			return err
+		}
+
+		return Shutdown(cmd.Context(), runner, when)
 	},
 }
 
-// Shutdown updates the machine, tidies up, and shuts down
-func Shutdown() error {
-	if err := Upgrade([]string{}); err != nil {
+// Shutdown updates the machine, tidies up, and shuts down, or if when is set, schedules a
+// shutdown with shutdown
+func Shutdown(ctx context.Context, r shell.Runner, when string) error {
+	// Failures updating individual packages are reported, but don't stop the shutdown
+	rep := report.New()
+	if err := Upgrade(ctx, r, rep, []string{}); err != nil {
+		rep.Write(stdout, output)
+		return err
+	}
+
+	var trimErr error
+	rep.Time("shutdown", "fstrim", func() (report.Entry, error) {
+		trimErr = r.Sudo(ctx, "fstrim", "--all", "--verbose")
+		return report.Entry{Status: report.Updated}, trimErr
+	})
+
+	if err := rep.Write(stdout, output); err != nil {
 		return err
 	}
+	if trimErr != nil {
+		return fmt.Errorf("trimming file systems: %s", trimErr)
+	}
 
-	if err := shell.Sudo("fstrim", "--all", "--verbose"); err != nil {
-		return fmt.Errorf("trimming file systems: %s", err)
+	if err := checkSafe(ctx, r, "shut down"); err != nil {
+		return err
 	}
 
-	if err := shell.Sudo("halt", "-p"); err != nil {
-		return fmt.Errorf("updating packages: %s", err)
+	if when != "" {
+		if err := r.Sudo(ctx, "shutdown", "-P", when, fmt.Sprintf(scheduleMessage, "shutting down")); err != nil {
+			return fmt.Errorf("scheduling shutdown: %s", err)
+		}
+		fmt.Printf("shutdown scheduled for %s, run jat cancel to stop it\n", when)
+		return rep.Err()
 	}
 
-	return nil
+	if err := r.Sudo(ctx, "halt", "-p"); err != nil {
+		return fmt.Errorf("shutting down: %s", err)
+	}
+
+	return rep.Err()
 }
 
 func init() {
 	rootCmd.AddCommand(shutdownCmd)
+	addOutputFlag(shutdownCmd)
+
+	shutdownCmd.Flags().StringVar(&powerAt, "at", "", "update now, then shut down at this time (HH:MM)")
+	shutdownCmd.Flags().DurationVar(&powerIn, "in", 0, "update now, then shut down after this long (e.g. 15m)")
+	shutdownCmd.Flags().BoolVar(&force, "force", false, "shut down even if preflight checks find something that would be interrupted")
 }
@@ -0,0 +1,55 @@
+/*
+Copyright © 2020 James Tunnicliffe <dooferlad@nanosheep.org>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dooferlad/jat/state"
+	"github.com/dooferlad/jat/utils"
+	"github.com/spf13/cobra"
+)
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status [NAME...]",
+	Short: "show binary packages installed by jat",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := state.Load()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tVERSION\tINSTALLED\tURL")
+		for _, name := range s.Names() {
+			if len(args) > 0 && !utils.InList(name, args) {
+				continue
+			}
+			r, _ := s.Get(name)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Name, r.Version, r.Time.Format(time.RFC3339), r.DownloadURL)
+		}
+
+		return w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+}
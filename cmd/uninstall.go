@@ -0,0 +1,35 @@
+/*
+Copyright © 2020 James Tunnicliffe <dooferlad@nanosheep.org>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/dooferlad/jat/blob"
+	"github.com/spf13/cobra"
+)
+
+// uninstallCmd represents the uninstall command
+var uninstallCmd = &cobra.Command{
+	Use:   "uninstall NAME",
+	Short: "remove a package installed using instructions in config file",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return blob.Uninstall(cmd.Context(), runner, args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(uninstallCmd)
+}
@@ -15,17 +15,52 @@
 package cmd
 
 import (
-	"errors"
+	"bufio"
+	"context"
 	"fmt"
-	"os/exec"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/dooferlad/jat/blob"
+	"github.com/dooferlad/jat/needrestart"
+	"github.com/dooferlad/jat/pkgmgr"
+	"github.com/dooferlad/jat/plan"
+	"github.com/dooferlad/jat/report"
 	"github.com/dooferlad/jat/shell"
+	"github.com/dooferlad/jat/updaters"
+	"github.com/dooferlad/jat/zfs"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
-func Upgrade(args []string) error {
-	if err := blob.Update(args); err != nil {
+// Upgrade updates binary packages, system packages and anything else that has an updater
+// switched on, adding the outcome of each step to rep. Only failing to update system
+// packages, or being interrupted, returns an error; other failures are left in rep.
+func Upgrade(ctx context.Context, r shell.Runner, rep *report.Report, args []string) error {
+	// Debs installed as blobs change the root file system too, so the snapshot comes first
+	var snap snapshotConfig
+	if err := viper.UnmarshalKey("snapshot", &snap); err != nil {
+		return err
+	}
+	snapshot := zfs.SnapshotName(time.Now())
+	if len(snap.Datasets) > 0 {
+		var snapErr error
+		rep.Time("snapshot", snapshot, func() (report.Entry, error) {
+			snapErr = takeSnapshot(ctx, r, snap, snapshot)
+			e := report.Entry{Status: report.Updated, Detail: strings.Join(snap.Datasets, ", ")}
+			if plan.DryRun() {
+				e.Status = report.Skipped
+				e.Detail = "dry run: " + e.Detail
+			}
+			return e, snapErr
+		})
+		if snapErr != nil {
+			return snapErr
+		}
+	}
+
+	if err := blob.Update(ctx, r, rep, args); err != nil {
 		return err
 	}
 
@@ -33,35 +68,156 @@ func Upgrade(args []string) error {
 		return nil
 	}
 
-	if err := shell.Sudo("pkcon", "refresh"); err != nil {
-		return fmt.Errorf("updating packages: %s", err)
+	// Services only need restarting if something they might have loaded was replaced
+	packagesChanged := false
+
+	backend, err := pkgmgr.Get(viper.GetString("package_manager"))
+	if err != nil {
+		return err
+	}
+	if backend != nil {
+		var updateErr error
+		rep.Time("packages", backend.Name(), func() (report.Entry, error) {
+			e := report.Entry{Status: report.Unchanged}
+			changed, err := pkgmgr.Update(ctx, r, backend)
+			packagesChanged = changed
+			if changed {
+				e.Status = report.Updated
+				if plan.DryRun() {
+					e.Status = report.Skipped
+					e.Detail = "dry run"
+				}
+			}
+			updateErr = err
+			return e, err
+		})
+		if updateErr != nil {
+			if len(snap.Datasets) > 0 {
+				printRollback(ctx, r, snap.Datasets, snapshot)
+			}
+			return updateErr
+		}
 	}
 
-	if err := shell.Sudo("pkcon", "get-updates"); err != nil {
-		return nil
+	// Optional updaters report their own failures without failing the update
+	u, err := updaters.Enabled()
+	if err != nil {
+		return err
+	}
+	for _, result := range updaters.Run(ctx, r, u) {
+		e := report.Entry{
+			Step:     "updater",
+			Name:     result.Name,
+			Status:   report.Unchanged,
+			Detail:   strings.Join(result.Changed, ", "),
+			Duration: result.Duration,
+		}
+		if len(result.Changed) > 0 {
+			e.Status = report.Updated
+			if plan.DryRun() {
+				e.Status = report.Skipped
+				e.Detail = "dry run: " + e.Detail
+			}
+		}
+		rep.Add(e, result.Err)
 	}
 
-	if err := shell.Sudo("pkcon", "update", "-y", "--autoremove", "--allow-downgrade"); err != nil {
-		var e *exec.ExitError
-		errors.As(err, &e)
-		if e.ExitCode() == 5 { // No updates
-			return nil
+	var restart needrestart.Config
+	if err := viper.UnmarshalKey("restart_services", &restart); err != nil {
+		return err
+	}
+	if restart.Enabled && !packagesChanged && !rep.Changed("blob") {
+		fmt.Println("nothing was updated, not looking for services to restart")
+	} else if restart.Enabled {
+		start := time.Now()
+		results, err := needrestart.RestartServices(ctx, r, restart, confirm)
+		if err != nil {
+			rep.Add(report.Entry{Step: "restart", Name: "services", Duration: time.Since(start)}, err)
+		}
+		for _, result := range results {
+			e := report.Entry{
+				Step:   "restart",
+				Name:   result.Unit,
+				Status: report.Updated,
+			}
+			if !result.Restarted {
+				e.Status = report.Skipped
+				e.Detail = "needs restart: " + result.Reason
+			}
+			rep.Add(e, result.Err)
 		}
-		return fmt.Errorf("updating packages: %s", err)
 	}
 
 	return nil
 }
 
+// snapshotConfig is the "snapshot" section of the config file
+type snapshotConfig struct {
+	// Datasets are snapshotted, recursively, before anything is upgraded
+	Datasets []string
+	// Keep is how many pre-upgrade snapshots of each dataset to keep
+	Keep int
+}
+
+// defaultSnapshotKeep is how many pre-upgrade snapshots are kept if the config doesn't say
+const defaultSnapshotKeep = 5
+
+// takeSnapshot snapshots the configured datasets then prunes old pre-upgrade snapshots
+func takeSnapshot(ctx context.Context, r shell.Runner, c snapshotConfig, name string) error {
+	if err := zfs.Snapshot(ctx, r, c.Datasets, name); err != nil {
+		return err
+	}
+
+	keep := c.Keep
+	if keep <= 0 {
+		keep = defaultSnapshotKeep
+	}
+	return zfs.Prune(ctx, r, c.Datasets, keep)
+}
+
+// printRollback tells the user how to undo a failed upgrade using the snapshot taken before it
+func printRollback(ctx context.Context, r shell.Runner, datasets []string, name string) {
+	commands, err := zfs.RollbackCommands(ctx, r, datasets, name)
+	if err != nil || len(commands) == 0 {
+		fmt.Printf("upgrade failed; the system was snapshotted as @%s before it started\n", name)
+		return
+	}
+
+	fmt.Printf("upgrade failed; to go back to the snapshot taken before it, run:\n  %s\n", strings.Join(commands, "\n  "))
+	fmt.Println("then reboot to start the restored root file system")
+}
+
+// stdin reads answers to confirm. It is shared so input buffered while reading one answer
+// isn't lost before the next question.
+var stdin = bufio.NewReader(os.Stdin)
+
+// confirm asks the user a yes or no question about restarting unit
+func confirm(unit string) bool {
+	fmt.Printf("%s is running replaced libraries, restart it? [y/N] ", unit)
+	answer, _ := stdin.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
 // updateCmd represents the update command
 var updateCmd = &cobra.Command{
 	Use:   "update",
 	Short: "Update software on this machine",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return Upgrade(args)
+		rep := report.New()
+		if err := Upgrade(cmd.Context(), runner, rep, args); err != nil {
+			rep.Write(stdout, output)
+			return err
+		}
+
+		if err := rep.Write(stdout, output); err != nil {
+			return err
+		}
+		return rep.Err()
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(updateCmd)
+	addOutputFlag(updateCmd)
 }
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dooferlad/jat/plan"
+	"github.com/dooferlad/jat/report"
+	"github.com/dooferlad/jat/shell"
+	"github.com/dooferlad/jat/zfs"
+	"github.com/spf13/viper"
+)
+
+func TestUpgradeRestartsOnlyAfterChanges(t *testing.T) {
+	quietConfig(t)
+	viper.Set("restart_services.enabled", true)
+	viper.Set("restart_services.allow", []string{"*"})
+
+	f := shell.NewFake()
+	rep := report.New()
+	if err := Upgrade(context.Background(), f, rep, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(f.CommandLines()) != 0 {
+		t.Errorf("ran %q with nothing updated", f.CommandLines())
+	}
+	for _, e := range rep.Entries() {
+		if e.Step == "restart" {
+			t.Errorf("looked for services to restart with nothing updated: %+v", e)
+		}
+	}
+}
+
+func TestUpgradeSnapshotsFirst(t *testing.T) {
+	quietConfig(t)
+	viper.Set("package_manager", "apt")
+	viper.Set("snapshot.datasets", []string{"rpool/ROOT"})
+	viper.Set("binary_blobs", map[string]interface{}{
+		"tool": map[string]interface{}{"package_type": "deb"},
+	})
+
+	for _, dryRun := range []bool{false, true} {
+		plan.SetDryRun(dryRun)
+		defer plan.SetDryRun(false)
+
+		f := shell.NewFake()
+		rep := report.New()
+		if err := Upgrade(context.Background(), f, rep, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		ran := f.CommandLines()
+		if len(ran) == 0 || !strings.HasPrefix(ran[0], "sudo zfs snapshot -r rpool/ROOT@"+zfs.SnapshotPrefix) {
+			t.Errorf("ran %q, want the snapshot first", ran)
+		}
+
+		want := report.Updated
+		if dryRun {
+			want = report.Skipped
+		}
+		if e := rep.Entries()[0]; e.Step != "snapshot" || e.Status != want {
+			t.Errorf("dry run %v: got %+v first, want a %s snapshot", dryRun, e, want)
+		}
+	}
+}
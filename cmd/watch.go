@@ -16,17 +16,164 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"regexp"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/dooferlad/jat/shell"
+	"github.com/dooferlad/jat/utils"
+	"github.com/dooferlad/jat/watch"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 var match string
 var mismatch string
+var changes bool
+var stream bool
+var interval time.Duration
+var count int
+var untilMatch string
+var untilExitCode int
+var keepGoing bool
+var alertCommand string
+var alertWebhook string
+var alertNotify bool
+var alertSyslog bool
+var alertEvery time.Duration
+var threshold string
+var seriesFile string
+var seriesFormat string
+
+// watchFilter decides which output is logged from the --match, --mismatch and --threshold
+// flags, and when to stop from --until-match and --until-exit-code
+type watchFilter struct {
+	match    *regexp.Regexp
+	mismatch *regexp.Regexp
+	until    *regexp.Regexp
+	// untilExit is true if --until-exit-code was given
+	untilExit bool
+
+	threshold *watch.Threshold
+	// series records the fields extracted by --match if --series was given
+	series *watch.Series
+}
+
+func newWatchFilter(cmd *cobra.Command) (*watchFilter, error) {
+	f := watchFilter{
+		untilExit: cmd.Flags().Changed("until-exit-code"),
+	}
+	var err error
+
+	if match != "" {
+		if f.match, err = regexp.Compile(match); err != nil {
+			return nil, err
+		}
+	}
+	if mismatch != "" {
+		if f.mismatch, err = regexp.Compile(mismatch); err != nil {
+			return nil, err
+		}
+	}
+
+	if untilMatch != "" {
+		if f.until, err = regexp.Compile(untilMatch); err != nil {
+			return nil, err
+		}
+	}
+
+	names := watch.FieldNames(f.match)
+	if threshold != "" {
+		if f.threshold, err = watch.ParseThreshold(threshold); err != nil {
+			return nil, err
+		}
+		if !utils.InList(f.threshold.Field, names) {
+			return nil, fmt.Errorf("--threshold uses %s, which needs to be a named group, (?P<%s>...), in --match", f.threshold.Field, f.threshold.Field)
+		}
+	}
+	if seriesFile != "" {
+		if len(names) == 0 {
+			return nil, fmt.Errorf("--series needs named groups, (?P<name>...), in --match")
+		}
+		if f.series, err = watch.NewSeries(seriesFile, seriesFormat, names); err != nil {
+			return nil, err
+		}
+	}
+
+	return &f, nil
+}
+
+// close closes the series file, if there is one
+func (f *watchFilter) close() {
+	if f.series != nil {
+		f.series.Close()
+	}
+}
+
+// sample extracts the named groups of --match from output, records them in the series,
+// and returns them along with whether output should be logged and alerted on. With a
+// threshold that is whether it is active, otherwise whether output is wanted.
+func (f *watchFilter) sample(t time.Time, output []byte) (map[string]string, bool) {
+	fields := watch.Fields(f.match, output)
+	if f.series != nil && len(fields) > 0 {
+		if err := f.series.Write(t, fields); err != nil {
+			logrus.WithError(err).Warn("writing series")
+		}
+	}
+
+	if f.threshold != nil {
+		return fields, f.threshold.Sample(fields)
+	}
+	return fields, f.wanted(output)
+}
+
+// matchedUntil returns true if output matches --until-match
+func (f *watchFilter) matchedUntil(output []byte) bool {
+	return f.until != nil && f.until.Match(output)
+}
+
+// exitedUntil returns true if exitCode is the one given to --until-exit-code
+func (f *watchFilter) exitedUntil(exitCode int) bool {
+	return f.untilExit && exitCode == untilExitCode
+}
+
+// wanted returns true if output should be logged: when it matches --match, doesn't match
+// --mismatch, or neither was given
+func (f *watchFilter) wanted(output []byte) bool {
+	if f.match == nil && f.mismatch == nil {
+		return true
+	}
+	if f.match != nil && f.match.Match(output) {
+		return true
+	}
+	return f.mismatch != nil && !f.mismatch.Match(output)
+}
+
+// newAlerter returns an alerter with the actions asked for by the --alert flags
+func newAlerter(command string, commandArgs []string) *watch.Alerter {
+	a := watch.Alerter{
+		Command: strings.Join(append([]string{command}, commandArgs...), " "),
+		Every:   alertEvery,
+	}
+
+	if alertCommand != "" {
+		a.Actions = append(a.Actions, watch.Command{Runner: runner, Command: alertCommand})
+	}
+	if alertWebhook != "" {
+		a.Actions = append(a.Actions, watch.Webhook{URL: alertWebhook})
+	}
+	if alertNotify {
+		a.Actions = append(a.Actions, watch.Notify{Runner: runner})
+	}
+	if alertSyslog {
+		a.Actions = append(a.Actions, watch.Syslog{})
+	}
+
+	return &a
+}
 
 // watchCmd represents the watch command
 var watchCmd = &cobra.Command{
@@ -37,6 +184,29 @@ var watchCmd = &cobra.Command{
 If match or mismatch are provided only log lines that match/don't match those
 flags.
 
+With --changes the output is only logged when it differs from the last run, as a
+unified diff against it.
+
+With --stream the command is left running, like tail -f or journalctl -f, and
+each line of its output is matched and logged as it arrives. The command is
+restarted if it exits.
+
+The command is run every --interval until it has run --count times, its output
+matches --until-match, or it exits with --until-exit-code. With --stream there is
+no interval, and --count limits how many times the command is started. If it fails the watch
+stops, unless --keep-going is given, in which case the exit code is logged and it
+is retried with an increasing delay.
+
+The --alert flags act when the output starts matching, and again when it stops
+matching. Each action fires at most once every --alert-every, reminders included,
+and a resolution sooner than that after it fired is held back until the time is up.
+
+Named groups in --match, like (?P<temp>[0-9.]+), are logged as fields, and can be
+written to a CSV or JSON lines file with --series. --threshold then decides when
+to log and alert instead of the match alone, e.g. "temp > 80 for 3 samples
+hysteresis 5" goes off after three samples over 80 in a row, and stays off until
+three samples in a row are 75 or below.
+
 To pass arguments to the command you are watching, prefix the list with "--", e.g.
 
   # watch the command "ls -R -X"
@@ -48,47 +218,150 @@ To pass arguments to the command you are watching, prefix the list with "--", e.
 		if len(args) == 0 {
 			return fmt.Errorf("no command given to watch")
 		}
+		if stream && changes {
+			return fmt.Errorf("--stream and --changes can't be used together")
+		}
+		if interval <= 0 {
+			return fmt.Errorf("--interval must be positive")
+		}
+		if stream && cmd.Flags().Changed("interval") {
+			return fmt.Errorf("--interval can't be used with --stream, which keeps the command running")
+		}
 
 		return nil
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		m, err := regexp.Compile(match)
+		filter, err := newWatchFilter(cmd)
 		if err != nil {
 			return err
 		}
+		defer filter.close()
 
-		v, err := regexp.Compile(mismatch)
-		if err != nil {
-			return err
+		if stream {
+			return watchStream(cmd.Context(), filter, args[0], args[1:])
 		}
 
-		command := args[0]
-		var commandArgs []string
-		if len(args) > 1 {
-			commandArgs = args[1:len(args)]
+		return watchPoll(cmd.Context(), filter, args[0], args[1:])
+	},
+}
+
+// watchPoll runs command every interval, logging its output
+func watchPoll(ctx context.Context, filter *watchFilter, command string, commandArgs []string) error {
+	alerter := newAlerter(command, commandArgs)
+	defer alerter.Close()
+	var previous []byte
+	var previousTime time.Time
+	backoff := watch.Backoff{Min: interval, Max: 5 * time.Minute, Jitter: 0.2}
+	// Watched commands can legitimately take a long time, so they aren't given the short
+	// capture timeout
+	ctx = shell.WithOperation(ctx, "watch")
+	for runs := 1; ; runs++ {
+		start := time.Now()
+		out, err := runner.Capture(ctx, command, commandArgs...)
+		if ctx.Err() != nil {
+			return nil // Interrupted
 		}
+		exitCode := shell.ExitCode(err)
+		finished := filter.matchedUntil(out) || filter.exitedUntil(exitCode)
 
-		for {
-			start := time.Now()
-			out, err := shell.Capture(command, commandArgs...)
-			if err != nil {
+		wait := interval
+		if err != nil {
+			// A failed run says nothing about whether the output matches, so it neither
+			// fires nor resolves an alert
+			if !keepGoing && !finished {
 				return err
 			}
-
-			if match != "" && m.Match(out) {
-				logrus.Info(string(out))
-			} else if mismatch != "" && !v.Match(out) {
-				logrus.Info(string(out))
-			} else if match == "" && mismatch == "" {
-				logrus.Info(string(out))
+			wait = backoff.Next()
+			logrus.WithField("exit_code", exitCode).Warn(string(out))
+		} else {
+			backoff.Reset()
+			fields, matching := filter.sample(start, out)
+			log := logrus.WithFields(watch.LogFields(fields))
+			if !changes {
+				if matching {
+					log.Info(string(out))
+				}
+			} else if previousTime.IsZero() {
+				log.Info(string(out))
+			} else if diff := watch.Diff(watch.Lines(previous), watch.Lines(out), previousTime, start); diff != "" && matching {
+				log.Info("output changed\n" + diff)
 			}
+			previous, previousTime = out, start
+			alerter.Update(ctx, matching, string(out))
+		}
+
+		if finished || runs == count {
+			return nil
+		}
 
-			duration := time.Since(start)
-			if duration < time.Second {
-				time.Sleep(time.Second - duration)
+		duration := time.Since(start)
+		if duration < wait {
+			select {
+			case <-time.After(wait - duration):
+			case <-ctx.Done():
+				return nil
 			}
 		}
-	},
+	}
+}
+
+// watchStream runs command until interrupted, logging each line it outputs. The command
+// is started at most --count times.
+func watchStream(ctx context.Context, filter *watchFilter, command string, commandArgs []string) error {
+	followCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	alerter := newAlerter(command, commandArgs)
+	defer alerter.Close()
+
+	// Without a threshold a stream has stopped matching once no line has matched for
+	// --alert-every, which quiet resolves when no more lines arrive. It runs alongside
+	// the line callback, so the alerter is shared under alertMutex.
+	var alertMutex sync.Mutex
+	quiet := time.AfterFunc(alertEvery, func() {
+		alertMutex.Lock()
+		defer alertMutex.Unlock()
+		alerter.Update(ctx, false, fmt.Sprintf("no matching output for %s", alertEvery))
+	})
+	quiet.Stop()
+	defer quiet.Stop()
+
+	var failed error
+	runs := 0
+	watch.Follow(followCtx, runner, func(stream, text string) {
+		if filter.matchedUntil([]byte(text)) {
+			cancel()
+		}
+
+		fields, matching := filter.sample(time.Now(), []byte(text))
+		if filter.threshold != nil && fields == nil {
+			return // Only lines with values move the threshold
+		}
+		if matching {
+			logrus.WithFields(watch.LogFields(fields)).WithField("stream", stream).Info(text)
+		}
+
+		alertMutex.Lock()
+		defer alertMutex.Unlock()
+		if filter.threshold != nil {
+			alerter.Update(ctx, matching, text)
+		} else if matching {
+			alerter.Update(ctx, true, text)
+			quiet.Reset(alertEvery)
+		}
+	}, func(err error) bool {
+		runs++
+		if filter.exitedUntil(shell.ExitCode(err)) {
+			return false
+		}
+		if err != nil && !keepGoing {
+			failed = err
+			return false
+		}
+		return runs != count
+	}, command, commandArgs...)
+
+	return failed
 }
 
 func init() {
@@ -96,6 +369,21 @@ func init() {
 
 	watchCmd.Flags().StringVarP(&match, "match", "m", "", "log matching output")
 	watchCmd.Flags().StringVarP(&mismatch, "mismatch", "v", "", "log non-matching output")
+	watchCmd.Flags().BoolVar(&changes, "changes", false, "only log output that differs from the last run, as a diff")
+	watchCmd.Flags().DurationVar(&interval, "interval", time.Second, "how often to run the command (not with --stream)")
+	watchCmd.Flags().IntVar(&count, "count", 0, "stop after running the command this many times (0 for no limit)")
+	watchCmd.Flags().StringVar(&untilMatch, "until-match", "", "stop when the output matches this")
+	watchCmd.Flags().IntVar(&untilExitCode, "until-exit-code", 0, "stop when the command exits with this code")
+	watchCmd.Flags().BoolVar(&keepGoing, "keep-going", false, "log the exit code and retry, with backoff, when the command fails")
+	watchCmd.Flags().StringVar(&alertCommand, "alert-command", "", "run this shell command on alerts, with the state and output as $1 and $2")
+	watchCmd.Flags().StringVar(&alertWebhook, "alert-webhook", "", "POST alerts as JSON to this URL")
+	watchCmd.Flags().BoolVar(&alertNotify, "alert-notify", false, "show alerts as desktop notifications")
+	watchCmd.Flags().BoolVar(&alertSyslog, "alert-syslog", false, "write alerts to syslog")
+	watchCmd.Flags().DurationVar(&alertEvery, "alert-every", 5*time.Minute, "fire each alert at most this often, holding back resolutions that come sooner")
+	watchCmd.Flags().StringVar(&threshold, "threshold", "", `log and alert when a field from --match crosses a threshold, e.g. "temp > 80 for 3 samples hysteresis 5"`)
+	watchCmd.Flags().StringVar(&seriesFile, "series", "", "append the fields extracted by --match to this file")
+	watchCmd.Flags().StringVar(&seriesFormat, "series-format", "", "csv or json (lines); by default csv if --series ends .csv, otherwise json")
+	watchCmd.Flags().BoolVarP(&stream, "stream", "f", false, "keep the command running and log each line as it is output")
 
 	logrus.SetFormatter(&logrus.TextFormatter{
 		// DisableColors: true,
@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/dooferlad/jat/shell"
+)
+
+// fakeWatch runs watches through f with a short interval, putting the flags back afterwards
+func fakeWatch(t *testing.T, f *shell.Fake) {
+	oldRunner, oldInterval, oldCount, oldKeepGoing, oldUntilExitCode := runner, interval, count, keepGoing, untilExitCode
+	oldAlertCommand, oldAlertEvery := alertCommand, alertEvery
+	t.Cleanup(func() {
+		runner, interval, count, keepGoing, untilExitCode = oldRunner, oldInterval, oldCount, oldKeepGoing, oldUntilExitCode
+		alertCommand, alertEvery = oldAlertCommand, oldAlertEvery
+	})
+
+	runner = f
+	interval = time.Millisecond
+	count = 0
+	keepGoing = false
+	alertCommand = ""
+}
+
+func TestWatchPoll(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		response  shell.Response
+		filter    watchFilter
+		count     int
+		keepGoing bool
+		untilExit int
+		runs      int
+		fails     bool
+	}{
+		{
+			name:  "count",
+			count: 3,
+			runs:  3,
+		},
+		{
+			name:     "until match",
+			response: shell.Response{Output: []byte("pool is ONLINE\n")},
+			filter:   watchFilter{until: regexp.MustCompile("ONLINE")},
+			runs:     1,
+		},
+		{
+			name:      "until exit code",
+			response:  shell.Response{ExitCode: 1},
+			filter:    watchFilter{untilExit: true},
+			untilExit: 1,
+			runs:      1,
+		},
+		{
+			name:     "failure stops",
+			response: shell.Response{ExitCode: 2},
+			runs:     1,
+			fails:    true,
+		},
+		{
+			name:      "keep going",
+			response:  shell.Response{ExitCode: 2},
+			count:     3,
+			keepGoing: true,
+			runs:      3,
+		},
+		{
+			name:      "until exit code with keep going",
+			response:  shell.Response{ExitCode: 0},
+			filter:    watchFilter{untilExit: true},
+			count:     5,
+			keepGoing: true,
+			runs:      1,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			f := shell.NewFake()
+			f.Default = test.response
+			fakeWatch(t, f)
+			count, keepGoing, untilExitCode = test.count, test.keepGoing, test.untilExit
+
+			err := watchPoll(context.Background(), &test.filter, "probe", nil)
+			if (err != nil) != test.fails {
+				t.Errorf("got error %v, want failure %t", err, test.fails)
+			}
+			if calls := f.Calls(); len(calls) != test.runs {
+				t.Errorf("ran the command %d times, want %d", len(calls), test.runs)
+			}
+		})
+	}
+}
+
+func TestWatchStreamUntilMatch(t *testing.T) {
+	f := shell.NewFake().On("journalctl -f", shell.Response{Output: []byte("starting\nready\nserving\n")})
+	fakeWatch(t, f)
+
+	filter := watchFilter{until: regexp.MustCompile("ready")}
+	if err := watchStream(context.Background(), &filter, "journalctl", []string{"-f"}); err != nil {
+		t.Fatal(err)
+	}
+	if calls := f.Calls(); len(calls) != 1 {
+		t.Errorf("started the command %d times, want once", len(calls))
+	}
+}
+
+func TestWatchStreamFailure(t *testing.T) {
+	f := shell.NewFake().On("journalctl -f", shell.Response{ExitCode: 1})
+	fakeWatch(t, f)
+
+	if err := watchStream(context.Background(), &watchFilter{}, "journalctl", []string{"-f"}); err == nil {
+		t.Error("the command failing didn't stop the watch")
+	}
+	if calls := f.Calls(); len(calls) != 1 {
+		t.Errorf("started the command %d times, want once", len(calls))
+	}
+}
+
+func TestWatchStreamRejectsInterval(t *testing.T) {
+	oldStream, oldInterval := stream, interval
+	t.Cleanup(func() {
+		stream, interval = oldStream, oldInterval
+		watchCmd.Flags().Lookup("interval").Changed = false
+	})
+
+	stream = true
+	if err := watchCmd.Flags().Set("interval", "10s"); err != nil {
+		t.Fatal(err)
+	}
+	if err := watchCmd.Args(watchCmd, []string{"journalctl", "-f"}); err == nil {
+		t.Error("--interval was accepted with --stream")
+	}
+}
+
+// failsAfterFirst is a runner whose "probe" command matches on its first run, then fails
+type failsAfterFirst struct {
+	*shell.Fake
+	runs int
+}
+
+func (f *failsAfterFirst) Capture(ctx context.Context, cmd string, arg ...string) ([]byte, error) {
+	if f.runs++; f.runs > 1 {
+		f.On("probe", shell.Response{ExitCode: 1})
+	}
+	return f.Fake.Capture(ctx, cmd, arg...)
+}
+
+func TestWatchPollFailureDoesNotResolve(t *testing.T) {
+	f := shell.NewFake().On("probe", shell.Response{Output: []byte("DEGRADED\n")})
+	fakeWatch(t, f)
+	runner = &failsAfterFirst{Fake: f}
+	alertCommand = "alert"
+	count, keepGoing = 3, true
+
+	filter := watchFilter{match: regexp.MustCompile("DEGRADED")}
+	if err := watchPoll(context.Background(), &filter, "probe", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Alerts are sent in the background, so only their order relative to each other is fixed
+	var runs int
+	var alerts []string
+	for _, c := range f.CommandLines() {
+		if c == "probe" {
+			runs++
+		} else {
+			alerts = append(alerts, c)
+		}
+	}
+	if runs != 3 {
+		t.Errorf("ran the command %d times, want 3", runs)
+	}
+	if want := []string{"sh -c alert jat firing DEGRADED\n"}; !reflect.DeepEqual(alerts, want) {
+		t.Errorf("got alerts %q, want %q", alerts, want)
+	}
+}
+
+func TestWatchStreamResolvesWhenQuiet(t *testing.T) {
+	f := shell.NewFake().On("journalctl -f", shell.Response{Output: []byte("error: disk on fire\n")})
+	fakeWatch(t, f)
+	alertCommand = "alert"
+	alertEvery = 10 * time.Millisecond
+	// The second start comes after Follow's restart delay, long after alertEvery, with the
+	// stream saying nothing in between
+	count = 2
+
+	filter := watchFilter{match: regexp.MustCompile("error")}
+	if err := watchStream(context.Background(), &filter, "journalctl", []string{"-f"}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"journalctl -f",
+		"sh -c alert jat firing error: disk on fire",
+		"sh -c alert jat resolved no matching output for 10ms",
+		"journalctl -f",
+		"sh -c alert jat firing error: disk on fire",
+	}
+	if got := f.CommandLines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
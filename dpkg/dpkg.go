@@ -1,8 +1,10 @@
 package dpkg
 
 import (
+	"context"
 	"encoding/json"
-	"os/exec"
+
+	"github.com/dooferlad/jat/shell"
 )
 
 type Version struct {
@@ -10,10 +12,9 @@ type Version struct {
 	Status  string
 }
 
-func Query(packageName string) (*Version, error) {
+func Query(ctx context.Context, r shell.Runner, packageName string) (*Version, error) {
 	dpkg := Version{}
-	exe := exec.Command("/usr/bin/dpkg-query", "--showformat={\"version\":\"${Version}\",\"status\":\"${Status}\"}", "--show", packageName)
-	out, err := exe.CombinedOutput()
+	out, err := r.Capture(ctx, "/usr/bin/dpkg-query", "--showformat={\"version\":\"${Version}\",\"status\":\"${Status}\"}", "--show", packageName)
 	if err != nil {
 		return &dpkg, err
 	}
@@ -1,6 +1,6 @@
 module github.com/dooferlad/jat
 
-go 1.13
+go 1.16
 
 require (
 	github.com/andybalholm/cascadia v1.3.1
@@ -9,6 +9,7 @@ require (
 	github.com/google/go-querystring v1.1.0 // indirect
 	github.com/google/shlex v0.0.0-20191202100458-e7afc7fbc510
 	github.com/juju/loggo v0.0.0-20210728185423-eebad3a902c4 // indirect
+	github.com/klauspost/compress v1.13.6
 	github.com/kr/pretty v0.3.0 // indirect
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/pkg/errors v0.9.1
@@ -16,6 +17,8 @@ require (
 	github.com/sirupsen/logrus v1.8.1
 	github.com/spf13/cobra v1.3.0
 	github.com/spf13/viper v1.10.1
+	github.com/ulikunitz/xz v0.5.10
+	golang.org/x/crypto v0.0.0-20211215153901-e495a2d5b3d3
 	golang.org/x/net v0.0.0-20211215060638-4ddde0e984e9
 	golang.org/x/sys v0.0.0-20211214234402-4825e8c3871d // indirect
 )
@@ -0,0 +1,295 @@
+package needrestart
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dooferlad/jat/shell"
+	"github.com/dooferlad/jat/version"
+	"github.com/sirupsen/logrus"
+)
+
+// Paths read by the checks, variables so they can be pointed somewhere else
+var (
+	procDir = "/proc"
+	bootDir = "/boot"
+	// rebootRequired is created by Debian and Ubuntu packages that need a reboot
+	rebootRequired = "/var/run/reboot-required"
+)
+
+// Process is a running process that still has a deleted library or executable mapped
+type Process struct {
+	PID     int
+	Command string
+	// Unit is the systemd service the process belongs to, empty if it isn't in one
+	Unit string
+	// User is true if Unit is managed by a user's systemd instance, not the system one
+	User  bool
+	Files []string
+}
+
+// RebootRequired returns the reasons a reboot is needed, if any: a reboot-required flag
+// left by the package manager, or a newer kernel than the one running
+func RebootRequired() ([]string, error) {
+	var reasons []string
+
+	if _, err := os.Stat(rebootRequired); err == nil {
+		reason := "reboot required by package manager"
+		if pkgs, err := ioutil.ReadFile(rebootRequired + ".pkgs"); err == nil {
+			if list := strings.Fields(string(pkgs)); len(list) > 0 {
+				reason += " (" + strings.Join(uniq(list), ", ") + ")"
+			}
+		}
+		reasons = append(reasons, reason)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	running, newest, err := Kernels()
+	if err != nil {
+		return nil, err
+	}
+	if newest != "" {
+		if c, err := version.CompareStrings(newest, running); err != nil {
+			logrus.Debugf("unable to compare kernel versions: %s", err)
+		} else if c > 0 {
+			reasons = append(reasons, "running kernel "+running+", newest installed is "+newest)
+		}
+	}
+
+	return reasons, nil
+}
+
+// Kernels returns the version of the running kernel and the newest one installed in /boot.
+// Images without a version in their name, such as Arch's vmlinuz-linux, are skipped, so the
+// newest is empty if none of them have one.
+func Kernels() (string, string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(procDir, "sys", "kernel", "osrelease"))
+	if err != nil {
+		return "", "", err
+	}
+	running := strings.TrimSpace(string(b))
+
+	images, err := filepath.Glob(filepath.Join(bootDir, "vmlinuz-*"))
+	if err != nil {
+		return "", "", err
+	}
+
+	var newest string
+	var newestVersion version.Version
+	for _, image := range images {
+		name := strings.TrimPrefix(filepath.Base(image), "vmlinuz-")
+		v, err := version.Parse(name)
+		if err != nil {
+			logrus.Debugf("skipping kernel image %s: %s", image, err)
+			continue
+		}
+		if newest == "" || version.Compare(v, newestVersion) > 0 {
+			newest, newestVersion = name, v
+		}
+	}
+
+	return running, newest, nil
+}
+
+// StaleProcesses finds processes that have a deleted library or executable mapped, which
+// means they are still running code that an upgrade has replaced. The memory maps of
+// processes belonging to other users, which includes most services, are read with sudo.
+func StaleProcesses(ctx context.Context, r shell.Runner) ([]Process, error) {
+	entries, err := ioutil.ReadDir(procDir)
+	if err != nil {
+		return nil, err
+	}
+
+	stale := map[int][]string{}
+	var unreadable []int
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+
+		files, err := deletedMappings(pid)
+		if err != nil {
+			unreadable = append(unreadable, pid)
+			continue
+		}
+		if len(files) > 0 {
+			stale[pid] = files
+		}
+	}
+
+	if len(unreadable) > 0 {
+		found, err := privilegedMappings(ctx, r, unreadable)
+		if err != nil {
+			logrus.Warnf("unable to read the memory maps of %d processes, services running replaced libraries may be missed: %s", len(unreadable), err)
+		}
+		for pid, files := range found {
+			stale[pid] = files
+		}
+	}
+
+	var procs []Process
+	for pid, files := range stale {
+		p := Process{
+			PID:   pid,
+			Files: files,
+		}
+		if comm, err := ioutil.ReadFile(filepath.Join(procDir, strconv.Itoa(pid), "comm")); err == nil {
+			p.Command = strings.TrimSpace(string(comm))
+		}
+		p.Unit, p.User = unit(pid)
+		procs = append(procs, p)
+	}
+	sort.Slice(procs, func(i, j int) bool { return procs[i].PID < procs[j].PID })
+
+	return procs, nil
+}
+
+// Units returns the system units of the given processes, sorted, without duplicates
+func Units(procs []Process) []string {
+	var units []string
+	for _, p := range procs {
+		if p.Unit != "" && !p.User {
+			units = append(units, p.Unit)
+		}
+	}
+	units = uniq(units)
+	sort.Strings(units)
+	return units
+}
+
+// deletedMappings returns the deleted libraries and executables mapped by a process
+func deletedMappings(pid int) ([]string, error) {
+	f, err := os.Open(filepath.Join(procDir, strconv.Itoa(pid), "maps"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var files []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if path, ok := deletedCode(scanner.Text()); ok {
+			files = append(files, path)
+		}
+	}
+
+	return uniq(files), scanner.Err()
+}
+
+// privilegedMappings reads the deleted libraries and executables mapped by processes the
+// user can't read the memory maps of, using a single sudo grep across all of them
+func privilegedMappings(ctx context.Context, r shell.Runner, pids []int) (map[int][]string, error) {
+	maps := map[string]int{}
+	args := []string{"grep", "--no-messages", "--with-filename", "--", " (deleted)$"}
+	for _, pid := range pids {
+		path := filepath.Join(procDir, strconv.Itoa(pid), "maps")
+		maps[path] = pid
+		args = append(args, path)
+	}
+
+	// grep exits 1 when nothing matched, and 2 when some processes exited before they
+	// were read, so only output that isn't grep's is treated as a failure
+	out, err := r.Capture(ctx, "sudo", args...)
+	if err != nil && shell.ExitCode(err) != 1 && shell.ExitCode(err) != 2 {
+		return nil, fmt.Errorf("%s: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	found := map[int][]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line == "" {
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			return found, fmt.Errorf("unexpected output from sudo grep: %s", line)
+		}
+		pid, ok := maps[line[:i]]
+		if !ok {
+			return found, fmt.Errorf("unexpected output from sudo grep: %s", line)
+		}
+		if path, ok := deletedCode(line[i+1:]); ok {
+			found[pid] = uniq(append(found[pid], path))
+		}
+	}
+
+	return found, nil
+}
+
+// deletedCode returns the path of a line from /proc/<pid>/maps if it is a library or
+// executable that has been deleted
+func deletedCode(line string) (string, bool) {
+	if !strings.HasSuffix(line, " (deleted)") {
+		return "", false
+	}
+
+	// The path is the sixth field, and may contain spaces
+	fields := strings.SplitN(line, " ", 6)
+	if len(fields) < 6 {
+		return "", false
+	}
+	path := strings.TrimSuffix(strings.TrimSpace(fields[5]), " (deleted)")
+	return path, isCode(path)
+}
+
+// isCode returns true for paths that look like libraries or executables installed by a
+// package manager, rather than shared memory or temporary files
+func isCode(path string) bool {
+	if strings.HasPrefix(path, "/memfd:") || strings.HasPrefix(path, "/dev/") ||
+		strings.HasPrefix(path, "/tmp/") || strings.HasPrefix(path, "/run/") ||
+		strings.HasPrefix(path, "/var/") || strings.HasPrefix(path, "/home/") {
+		return false
+	}
+
+	return strings.Contains(path, ".so") ||
+		strings.HasPrefix(path, "/usr/") ||
+		strings.HasPrefix(path, "/lib") ||
+		strings.HasPrefix(path, "/bin/") ||
+		strings.HasPrefix(path, "/sbin/")
+}
+
+// unit finds the systemd service a process runs in from its cgroup
+func unit(pid int) (string, bool) {
+	b, err := ioutil.ReadFile(filepath.Join(procDir, strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return "", false
+	}
+
+	for _, line := range strings.Split(string(b), "\n") {
+		// cgroup v2 is "0::/path", v1 has a line per controller and we want name=systemd
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 || (parts[0] != "0" && parts[1] != "name=systemd") {
+			continue
+		}
+
+		user := strings.Contains(parts[2], "/user@")
+		elements := strings.Split(parts[2], "/")
+		for i := len(elements) - 1; i >= 0; i-- {
+			if strings.HasSuffix(elements[i], ".service") {
+				return elements[i], user || strings.HasPrefix(elements[i], "user@")
+			}
+		}
+	}
+
+	return "", false
+}
+
+func uniq(list []string) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -0,0 +1,133 @@
+package needrestart
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dooferlad/jat/shell"
+)
+
+// fakeSystem points the checks at a temporary /proc and /boot with the given running kernel
+// and installed kernel images
+func fakeSystem(t *testing.T, running string, images ...string) {
+	dir := t.TempDir()
+	oldProc, oldBoot, oldFlag := procDir, bootDir, rebootRequired
+	procDir = filepath.Join(dir, "proc")
+	bootDir = filepath.Join(dir, "boot")
+	rebootRequired = filepath.Join(dir, "reboot-required")
+	t.Cleanup(func() {
+		procDir, bootDir, rebootRequired = oldProc, oldBoot, oldFlag
+	})
+
+	kernel := filepath.Join(procDir, "sys", "kernel")
+	if err := os.MkdirAll(kernel, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(kernel, "osrelease"), []byte(running+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(bootDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, image := range images {
+		if err := ioutil.WriteFile(filepath.Join(bootDir, image), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestKernels(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		running string
+		images  []string
+		newest  string
+		reasons []string
+	}{
+		{
+			name:    "running newest",
+			running: "5.15.0-91-generic",
+			images:  []string{"vmlinuz-5.15.0-88-generic", "vmlinuz-5.15.0-91-generic"},
+			newest:  "5.15.0-91-generic",
+		},
+		{
+			name:    "newer installed",
+			running: "5.15.0-88-generic",
+			images:  []string{"vmlinuz-5.15.0-88-generic", "vmlinuz-5.15.0-101-generic", "vmlinuz-5.15.0-91-generic"},
+			newest:  "5.15.0-101-generic",
+			reasons: []string{"running kernel 5.15.0-88-generic, newest installed is 5.15.0-101-generic"},
+		},
+		{
+			name:    "unversioned images",
+			running: "6.6.1-arch1-1",
+			images:  []string{"vmlinuz-linux", "vmlinuz-linux-lts"},
+		},
+		{
+			name:    "versioned and unversioned images",
+			running: "5.15.0-91-generic",
+			images:  []string{"vmlinuz-5.15.0-91-generic", "vmlinuz-a-custom"},
+			newest:  "5.15.0-91-generic",
+		},
+		{
+			name:    "running kernel removed",
+			running: "5.15.0-101-generic",
+			images:  []string{"vmlinuz-5.15.0-91-generic"},
+			newest:  "5.15.0-91-generic",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fakeSystem(t, test.running, test.images...)
+
+			running, newest, err := Kernels()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if running != test.running || newest != test.newest {
+				t.Errorf("got %q, %q, want %q, %q", running, newest, test.running, test.newest)
+			}
+
+			reasons, err := RebootRequired()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(reasons, test.reasons) {
+				t.Errorf("got reasons %q, want %q", reasons, test.reasons)
+			}
+		})
+	}
+}
+
+func TestPrivilegedMappings(t *testing.T) {
+	fakeSystem(t, "5.15.0-91-generic")
+	maps := func(pid string) string { return filepath.Join(procDir, pid, "maps") }
+
+	grep := "sudo grep --no-messages --with-filename --  (deleted)$ " + maps("1") + " " + maps("812")
+	f := shell.NewFake().On(grep, shell.Response{ExitCode: 2, Output: []byte(
+		maps("812") + ":7f2c1a000000-7f2c1a028000 r--p 00000000 fd:01 1234    /usr/lib/x86_64-linux-gnu/libssl.so.3 (deleted)\n" +
+			maps("812") + ":7f2c1a028000-7f2c1a0a0000 r-xp 00028000 fd:01 1234    /usr/lib/x86_64-linux-gnu/libssl.so.3 (deleted)\n" +
+			maps("812") + ":7f2c1b000000-7f2c1b200000 rw-s 00000000 00:01 99     /memfd:pulseaudio (deleted)\n")})
+
+	found, err := privilegedMappings(context.Background(), f, []int{1, 812})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int][]string{812: {"/usr/lib/x86_64-linux-gnu/libssl.so.3"}}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("got %v, want %v", found, want)
+	}
+
+	f.On(grep, shell.Response{ExitCode: 1})
+	if found, err := privilegedMappings(context.Background(), f, []int{1, 812}); err != nil || len(found) != 0 {
+		t.Errorf("got %v, %v with nothing deleted, want nothing", found, err)
+	}
+
+	f.On(grep, shell.Response{ExitCode: 1, Output: []byte("sudo: a password is required\n")})
+	if _, err := privilegedMappings(context.Background(), f, []int{1, 812}); err == nil {
+		t.Error("sudo failing wasn't reported")
+	}
+}
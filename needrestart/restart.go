@@ -0,0 +1,99 @@
+package needrestart
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/dooferlad/jat/plan"
+	"github.com/dooferlad/jat/shell"
+)
+
+// Config controls which services are restarted after an upgrade. It is read from
+// "restart_services" in the config file.
+type Config struct {
+	Enabled bool
+	// Allow lists units, or globs of units, to restart without asking
+	Allow []string
+	// Deny lists units that are never restarted, on top of neverRestart
+	Deny []string
+	// Confirm asks before restarting units that aren't allowed. Without it they are only
+	// reported.
+	Confirm bool
+}
+
+// neverRestart are units that take the desktop session, or the ability to log in, with
+// them when restarted
+var neverRestart = []string{
+	"dbus.service",
+	"dbus-broker.service",
+	"display-manager.service",
+	"gdm.service",
+	"gdm3.service",
+	"lightdm.service",
+	"sddm.service",
+	"systemd-logind.service",
+	"getty@*.service",
+	"user@*.service",
+}
+
+// Result is what happened to a unit that needed restarting
+type Result struct {
+	Unit      string
+	Restarted bool
+	// Reason explains why a unit wasn't restarted
+	Reason string
+	Err    error
+}
+
+// RestartServices finds system services running deleted libraries and restarts the ones
+// the config allows, asking confirm about the rest if the config says to. In a dry run the
+// restarts are planned and nobody is asked.
+func RestartServices(ctx context.Context, r shell.Runner, c Config, confirm func(unit string) bool) ([]Result, error) {
+	procs, err := StaleProcesses(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	for _, unit := range Units(procs) {
+		result := Result{Unit: unit}
+
+		switch {
+		case matchAny(unit, neverRestart) || matchAny(unit, c.Deny):
+			result.Reason = "never restarted automatically"
+		case matchAny(unit, c.Allow):
+			result.Restarted = true
+		case c.Confirm && !plan.DryRun():
+			if result.Restarted = confirm(unit); !result.Restarted {
+				result.Reason = "declined"
+			}
+		default:
+			result.Reason = "not in the allow list"
+		}
+
+		if result.Restarted && plan.DryRun() {
+			plan.Command("sudo", "systemctl", "restart", unit)
+			result.Restarted = false
+			result.Reason = "dry run"
+		} else if result.Restarted {
+			if err := r.Sudo(ctx, "systemctl", "restart", unit); err != nil {
+				result.Restarted = false
+				result.Err = fmt.Errorf("restarting %s: %s", unit, err)
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func matchAny(unit string, patterns []string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, unit); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package needrestart
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/dooferlad/jat/plan"
+	"github.com/dooferlad/jat/shell"
+)
+
+// fakeService adds a process to the fake /proc, running in unit with a deleted libssl mapped
+func fakeService(t *testing.T, pid int, unit string) {
+	dir := filepath.Join(procDir, strconv.Itoa(pid))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"comm":   unit + "\n",
+		"cgroup": "0::/system.slice/" + unit + "\n",
+		"maps":   "7f2c1a028000-7f2c1a0a0000 r-xp 00028000 fd:01 1234    /usr/lib/x86_64-linux-gnu/libssl.so.3 (deleted)\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRestartServices(t *testing.T) {
+	restart := func(unit string) string { return "sudo systemctl restart " + unit }
+
+	for _, test := range []struct {
+		name    string
+		config  Config
+		answers map[string]bool
+		dryRun  bool
+		want    []Result
+		ran     []string
+		planned []string
+	}{
+		{
+			name:   "allow",
+			config: Config{Allow: []string{"nginx*"}},
+			want: []Result{
+				{Unit: "cron.service", Reason: "not in the allow list"},
+				{Unit: "dbus.service", Reason: "never restarted automatically"},
+				{Unit: "nginx.service", Restarted: true},
+				{Unit: "ssh.service", Reason: "not in the allow list"},
+			},
+			ran: []string{restart("nginx.service")},
+		},
+		{
+			name:   "deny",
+			config: Config{Allow: []string{"*"}, Deny: []string{"ssh.service"}},
+			want: []Result{
+				{Unit: "cron.service", Restarted: true},
+				{Unit: "dbus.service", Reason: "never restarted automatically"},
+				{Unit: "nginx.service", Restarted: true},
+				{Unit: "ssh.service", Reason: "never restarted automatically"},
+			},
+			ran: []string{restart("cron.service"), restart("nginx.service")},
+		},
+		{
+			name:    "confirm",
+			config:  Config{Allow: []string{"nginx.service"}, Confirm: true},
+			answers: map[string]bool{"cron.service": true},
+			want: []Result{
+				{Unit: "cron.service", Restarted: true},
+				{Unit: "dbus.service", Reason: "never restarted automatically"},
+				{Unit: "nginx.service", Restarted: true},
+				{Unit: "ssh.service", Reason: "declined"},
+			},
+			ran: []string{restart("cron.service"), restart("nginx.service")},
+		},
+		{
+			name:   "dry run",
+			config: Config{Allow: []string{"nginx.service"}, Confirm: true},
+			dryRun: true,
+			want: []Result{
+				{Unit: "cron.service", Reason: "not in the allow list"},
+				{Unit: "dbus.service", Reason: "never restarted automatically"},
+				{Unit: "nginx.service", Reason: "dry run"},
+				{Unit: "ssh.service", Reason: "not in the allow list"},
+			},
+			planned: []string{restart("nginx.service")},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fakeSystem(t, "5.15.0-91-generic")
+			for pid, unit := range []string{"cron.service", "dbus.service", "nginx.service", "ssh.service"} {
+				fakeService(t, 100+pid, unit)
+			}
+
+			plan.SetDryRun(test.dryRun)
+			defer plan.SetDryRun(false)
+			before := len(plan.Steps())
+
+			var asked []string
+			confirm := func(unit string) bool {
+				asked = append(asked, unit)
+				return test.answers[unit]
+			}
+
+			f := shell.NewFake()
+			got, err := RestartServices(context.Background(), f, test.config, confirm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+			if !reflect.DeepEqual(f.CommandLines(), test.ran) {
+				t.Errorf("ran %q, want %q", f.CommandLines(), test.ran)
+			}
+
+			var planned []string
+			for _, s := range plan.Steps()[before:] {
+				planned = append(planned, s.String())
+			}
+			if !reflect.DeepEqual(planned, test.planned) {
+				t.Errorf("planned %q, want %q", planned, test.planned)
+			}
+
+			if !test.config.Confirm || test.dryRun {
+				if len(asked) > 0 {
+					t.Errorf("asked about %q", asked)
+				}
+			} else if want := []string{"cron.service", "ssh.service"}; !reflect.DeepEqual(asked, want) {
+				t.Errorf("asked about %q, want %q", asked, want)
+			}
+		})
+	}
+}
+
+func TestRestartServicesFailure(t *testing.T) {
+	fakeSystem(t, "5.15.0-91-generic")
+	fakeService(t, 100, "nginx.service")
+
+	f := shell.NewFake().On("sudo systemctl restart nginx.service", shell.Response{ExitCode: 1})
+	got, err := RestartServices(context.Background(), f, Config{Allow: []string{"*"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Restarted || got[0].Err == nil {
+		t.Errorf("got %+v, want a failed restart", got)
+	}
+}
@@ -0,0 +1,177 @@
+package pkgmgr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/dooferlad/jat/shell"
+)
+
+// PackageKit uses pkcon
+type PackageKit struct{}
+
+// pkconNothingToDo is the exit code pkcon uses when there are no updates
+const pkconNothingToDo = 5
+
+func (PackageKit) Name() string    { return "packagekit" }
+func (PackageKit) Command() string { return "pkcon" }
+
+func (PackageKit) Refresh(ctx context.Context, r shell.Runner) error {
+	return r.Sudo(ctx, "pkcon", "refresh")
+}
+
+func (PackageKit) Pending(ctx context.Context, r shell.Runner) (bool, error) {
+	out, err := r.Capture(ctx, "pkcon", "get-updates")
+	if shell.ExitCode(err) == pkconNothingToDo {
+		return false, nil
+	}
+	if err != nil {
+		return false, shellError(err, out)
+	}
+	fmt.Print(string(out))
+	return true, nil
+}
+
+func (PackageKit) Upgrade(ctx context.Context, r shell.Runner) error {
+	err := r.Sudo(ctx, "pkcon", "update", "-y", "--autoremove", "--allow-downgrade")
+	if shell.ExitCode(err) == pkconNothingToDo {
+		return nil
+	}
+	return err
+}
+
+// Apt uses apt-get
+type Apt struct{}
+
+var aptSummary = regexp.MustCompile(`(\d+) upgraded, (\d+) newly installed, (\d+) to remove`)
+
+func (Apt) Name() string    { return "apt" }
+func (Apt) Command() string { return "apt-get" }
+
+func (Apt) Refresh(ctx context.Context, r shell.Runner) error {
+	return r.Sudo(ctx, "apt-get", "update")
+}
+
+func (Apt) Pending(ctx context.Context, r shell.Runner) (bool, error) {
+	// A simulated upgrade doesn't need root, or the dpkg lock
+	out, err := r.Capture(ctx, "apt-get", "--simulate", "-o", "Debug::NoLocking=1", "dist-upgrade")
+	if err != nil {
+		return false, shellError(err, out)
+	}
+
+	m := aptSummary.FindSubmatch(out)
+	if m == nil {
+		return true, nil // Can't tell, so let the upgrade decide
+	}
+	return string(m[1]) != "0" || string(m[2]) != "0" || string(m[3]) != "0", nil
+}
+
+// aptNoninteractive stops apt-get and dpkg asking questions, keeping the local version of
+// any changed config file, so that an unattended upgrade can't hang at a prompt. It is
+// set through env because sudo resets the environment.
+var aptNoninteractive = []string{
+	"DEBIAN_FRONTEND=noninteractive", "apt-get", "-y",
+	"-o", "Dpkg::Options::=--force-confdef",
+	"-o", "Dpkg::Options::=--force-confold",
+}
+
+func (Apt) Upgrade(ctx context.Context, r shell.Runner) error {
+	if err := r.Sudo(ctx, "env", append(aptNoninteractive, "dist-upgrade")...); err != nil {
+		return err
+	}
+	return r.Sudo(ctx, "env", append(aptNoninteractive, "autoremove")...)
+}
+
+// Dnf uses dnf
+type Dnf struct{}
+
+// dnfUpdatesAvailable is the exit code of dnf check-update when there are updates
+const dnfUpdatesAvailable = 100
+
+func (Dnf) Name() string    { return "dnf" }
+func (Dnf) Command() string { return "dnf" }
+
+func (Dnf) Refresh(ctx context.Context, r shell.Runner) error {
+	return r.Sudo(ctx, "dnf", "makecache")
+}
+
+func (Dnf) Pending(ctx context.Context, r shell.Runner) (bool, error) {
+	out, err := r.Capture(ctx, "dnf", "--quiet", "check-update")
+	switch shell.ExitCode(err) {
+	case 0:
+		return false, nil
+	case dnfUpdatesAvailable:
+		return true, nil
+	}
+	return false, shellError(err, out)
+}
+
+func (Dnf) Upgrade(ctx context.Context, r shell.Runner) error {
+	if err := r.Sudo(ctx, "dnf", "-y", "upgrade"); err != nil {
+		return err
+	}
+	return r.Sudo(ctx, "dnf", "-y", "autoremove")
+}
+
+// Pacman uses pacman
+type Pacman struct{}
+
+func (Pacman) Name() string    { return "pacman" }
+func (Pacman) Command() string { return "pacman" }
+
+func (Pacman) Refresh(ctx context.Context, r shell.Runner) error {
+	// Safe because Upgrade always follows with -Su; a refresh on its own would leave a
+	// partial upgrade if something was installed in between
+	return r.Sudo(ctx, "pacman", "-Sy")
+}
+
+func (Pacman) Pending(ctx context.Context, r shell.Runner) (bool, error) {
+	// pacman -Qu exits 1 with no output when there is nothing to upgrade
+	out, err := r.Capture(ctx, "pacman", "-Qu")
+	if shell.ExitCode(err) == 1 && len(bytes.TrimSpace(out)) == 0 {
+		return false, nil
+	}
+	if err != nil {
+		return false, shellError(err, out)
+	}
+	return len(bytes.TrimSpace(out)) > 0, nil
+}
+
+func (Pacman) Upgrade(ctx context.Context, r shell.Runner) error {
+	return r.Sudo(ctx, "pacman", "-Su", "--noconfirm")
+}
+
+// Zypper uses zypper
+type Zypper struct{}
+
+// zypper exit codes that report success along with extra information
+const (
+	zypperRebootNeeded  = 102
+	zypperRestartNeeded = 103
+)
+
+func (Zypper) Name() string    { return "zypper" }
+func (Zypper) Command() string { return "zypper" }
+
+func (Zypper) Refresh(ctx context.Context, r shell.Runner) error {
+	return r.Sudo(ctx, "zypper", "--non-interactive", "refresh")
+}
+
+func (Zypper) Pending(ctx context.Context, r shell.Runner) (bool, error) {
+	out, err := r.Capture(ctx, "zypper", "--non-interactive", "list-updates")
+	if err != nil {
+		return false, shellError(err, out)
+	}
+	return !bytes.Contains(out, []byte("No updates found")), nil
+}
+
+func (Zypper) Upgrade(ctx context.Context, r shell.Runner) error {
+	err := r.Sudo(ctx, "zypper", "--non-interactive", "update")
+	switch shell.ExitCode(err) {
+	case zypperRebootNeeded, zypperRestartNeeded:
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,135 @@
+package pkgmgr
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/dooferlad/jat/shell"
+)
+
+func TestAptUpgradeIsNoninteractive(t *testing.T) {
+	f := shell.NewFake()
+	if err := (Apt{}).Upgrade(context.Background(), f); err != nil {
+		t.Fatal(err)
+	}
+
+	got := f.CommandLines()
+	want := []string{
+		"sudo env DEBIAN_FRONTEND=noninteractive apt-get -y -o Dpkg::Options::=--force-confdef -o Dpkg::Options::=--force-confold dist-upgrade",
+		"sudo env DEBIAN_FRONTEND=noninteractive apt-get -y -o Dpkg::Options::=--force-confdef -o Dpkg::Options::=--force-confold autoremove",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ran %q, want %q", got, want)
+	}
+}
+
+func TestPending(t *testing.T) {
+	const (
+		pkcon  = "pkcon get-updates"
+		apt    = "apt-get --simulate -o Debug::NoLocking=1 dist-upgrade"
+		dnf    = "dnf --quiet check-update"
+		pacman = "pacman -Qu"
+		zypper = "zypper --non-interactive list-updates"
+	)
+
+	tests := []struct {
+		name     string
+		backend  Backend
+		command  string
+		response shell.Response
+		want     bool
+		wantErr  bool
+	}{
+		{"pkcon updates", PackageKit{}, pkcon, shell.Response{Output: []byte("Normal \tbash-5.1-1.x86_64\n")}, true, false},
+		{"pkcon nothing to do", PackageKit{}, pkcon, shell.Response{ExitCode: 5}, false, false},
+		{"pkcon failed", PackageKit{}, pkcon, shell.Response{ExitCode: 1, Output: []byte("Fatal error")}, false, true},
+
+		{"apt updates", Apt{}, apt, shell.Response{Output: []byte("2 upgraded, 0 newly installed, 0 to remove and 0 not upgraded.\n")}, true, false},
+		{"apt removals", Apt{}, apt, shell.Response{Output: []byte("0 upgraded, 0 newly installed, 1 to remove and 0 not upgraded.\n")}, true, false},
+		{"apt up to date", Apt{}, apt, shell.Response{Output: []byte("0 upgraded, 0 newly installed, 0 to remove and 3 not upgraded.\n")}, false, false},
+		{"apt unknown output", Apt{}, apt, shell.Response{Output: []byte("Reading package lists...\n")}, true, false},
+		{"apt failed", Apt{}, apt, shell.Response{ExitCode: 100}, false, true},
+
+		{"dnf up to date", Dnf{}, dnf, shell.Response{}, false, false},
+		{"dnf updates", Dnf{}, dnf, shell.Response{ExitCode: 100, Output: []byte("bash.x86_64  5.1.8-2.fc35  updates\n")}, true, false},
+		{"dnf failed", Dnf{}, dnf, shell.Response{ExitCode: 1, Output: []byte("Error: Failed to download metadata")}, false, true},
+
+		{"pacman updates", Pacman{}, pacman, shell.Response{Output: []byte("bash 5.1.008-1 -> 5.1.012-1\n")}, true, false},
+		{"pacman up to date", Pacman{}, pacman, shell.Response{ExitCode: 1}, false, false},
+		{"pacman failed", Pacman{}, pacman, shell.Response{ExitCode: 1, Output: []byte("error: failed to init transaction")}, false, true},
+
+		{"zypper updates", Zypper{}, zypper, shell.Response{Output: []byte("v | repo-update | bash | 5.1-1 | 5.1-2 | x86_64\n")}, true, false},
+		{"zypper up to date", Zypper{}, zypper, shell.Response{Output: []byte("Loading repository data...\nNo updates found.\n")}, false, false},
+		{"zypper failed", Zypper{}, zypper, shell.Response{ExitCode: 4}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := shell.NewFake().On(tt.command, tt.response)
+			got, err := tt.backend.Pending(context.Background(), f)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if want := []string{tt.command}; !reflect.DeepEqual(f.CommandLines(), want) {
+				t.Errorf("ran %q, want %q", f.CommandLines(), want)
+			}
+		})
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	const (
+		pkcon  = "sudo pkcon update -y --autoremove --allow-downgrade"
+		zypper = "sudo zypper --non-interactive update"
+	)
+
+	tests := []struct {
+		name     string
+		backend  Backend
+		command  string
+		response shell.Response
+		want     []string
+		wantErr  bool
+	}{
+		{"pkcon", PackageKit{}, pkcon, shell.Response{}, []string{pkcon}, false},
+		{"pkcon nothing to do", PackageKit{}, pkcon, shell.Response{ExitCode: 5}, []string{pkcon}, false},
+		{"pkcon failed", PackageKit{}, pkcon, shell.Response{ExitCode: 1}, []string{pkcon}, true},
+
+		{"dnf", Dnf{}, "sudo dnf -y upgrade", shell.Response{}, []string{"sudo dnf -y upgrade", "sudo dnf -y autoremove"}, false},
+		{"dnf failed", Dnf{}, "sudo dnf -y upgrade", shell.Response{ExitCode: 1}, []string{"sudo dnf -y upgrade"}, true},
+
+		{"pacman", Pacman{}, "sudo pacman -Su --noconfirm", shell.Response{}, []string{"sudo pacman -Su --noconfirm"}, false},
+		{"pacman failed", Pacman{}, "sudo pacman -Su --noconfirm", shell.Response{ExitCode: 1}, []string{"sudo pacman -Su --noconfirm"}, true},
+
+		{"zypper", Zypper{}, zypper, shell.Response{}, []string{zypper}, false},
+		{"zypper reboot needed", Zypper{}, zypper, shell.Response{ExitCode: 102}, []string{zypper}, false},
+		{"zypper restart needed", Zypper{}, zypper, shell.Response{ExitCode: 103}, []string{zypper}, false},
+		{"zypper failed", Zypper{}, zypper, shell.Response{ExitCode: 104}, []string{zypper}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := shell.NewFake().On(tt.command, tt.response)
+			err := tt.backend.Upgrade(context.Background(), f)
+			if tt.wantErr && err == nil {
+				t.Error("succeeded, want an error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Error(err)
+			}
+			if !reflect.DeepEqual(f.CommandLines(), tt.want) {
+				t.Errorf("ran %q, want %q", f.CommandLines(), tt.want)
+			}
+		})
+	}
+}
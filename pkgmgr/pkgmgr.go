@@ -0,0 +1,101 @@
+package pkgmgr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+
+	"github.com/dooferlad/jat/shell"
+)
+
+// Backend updates the packages installed by a system package manager
+type Backend interface {
+	// Name is the name used to pick the backend in the config file
+	Name() string
+	// Command is the executable that has to be installed to use the backend
+	Command() string
+	// Refresh updates the package lists
+	Refresh(ctx context.Context, r shell.Runner) error
+	// Pending returns true if there are updates to install
+	Pending(ctx context.Context, r shell.Runner) (bool, error)
+	// Upgrade installs updates and removes packages that are no longer needed
+	Upgrade(ctx context.Context, r shell.Runner) error
+}
+
+// backends in the order they are tried when auto detecting. PackageKit comes first
+// because it fronts the native package manager where it is installed.
+var backends = []Backend{
+	PackageKit{},
+	Apt{},
+	Dnf{},
+	Pacman{},
+	Zypper{},
+}
+
+// Names lists the backends that can be chosen
+func Names() []string {
+	var names []string
+	for _, b := range backends {
+		names = append(names, b.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the backend called name, or the first available one if name is "" or
+// "auto". "none" returns nil, so system packages aren't updated.
+func Get(name string) (Backend, error) {
+	switch name {
+	case "none":
+		return nil, nil
+	case "", "auto":
+		for _, b := range backends {
+			if _, err := exec.LookPath(b.Command()); err == nil {
+				return b, nil
+			}
+		}
+		return nil, fmt.Errorf("no supported package manager found, tried %v", Names())
+	}
+
+	for _, b := range backends {
+		if b.Name() == name {
+			return b, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown package manager %q, expected one of %v", name, Names())
+}
+
+// Update refreshes the package lists and installs any updates, returning true if anything
+// was upgraded
+func Update(ctx context.Context, r shell.Runner, b Backend) (bool, error) {
+	if err := b.Refresh(ctx, r); err != nil {
+		return false, fmt.Errorf("%s: refreshing package lists: %s", b.Name(), err)
+	}
+
+	// Checking can mean downloading metadata, so it gets as long as the upgrade would
+	pending, err := b.Pending(shell.WithOperation(ctx, "command"), r)
+	if err != nil {
+		return false, fmt.Errorf("%s: checking for updates: %s", b.Name(), err)
+	}
+	if !pending {
+		fmt.Printf("%s: no updates\n", b.Name())
+		return false, nil
+	}
+
+	if err := b.Upgrade(ctx, r); err != nil {
+		return false, fmt.Errorf("%s: updating packages: %s", b.Name(), err)
+	}
+
+	return true, nil
+}
+
+// shellError adds the output of a captured command to its error
+func shellError(err error, out []byte) error {
+	if len(bytes.TrimSpace(out)) == 0 {
+		return err
+	}
+	return fmt.Errorf("%s: %s", err, bytes.TrimSpace(out))
+}
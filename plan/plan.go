@@ -0,0 +1,97 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+var mutex sync.Mutex
+var dryRun bool
+var steps []Step
+
+// Step is something jat would have done, had it not been a dry run
+type Step struct {
+	// Type is "command", "install", "extract", "uninstall", "rollback" or "up-to-date"
+	Type    string   `json:"type"`
+	Package string   `json:"package,omitempty"`
+	Command []string `json:"command,omitempty"`
+	URL     string   `json:"url,omitempty"`
+	// Member is the pattern matching the archive members an extract step installs
+	Member        string   `json:"member,omitempty"`
+	LocalVersion  string   `json:"local_version,omitempty"`
+	RemoteVersion string   `json:"remote_version,omitempty"`
+	Files         []string `json:"files,omitempty"`
+}
+
+// SetDryRun turns dry run mode on or off
+func SetDryRun(enabled bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	dryRun = enabled
+}
+
+// DryRun returns true if commands should be planned rather than run
+func DryRun() bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return dryRun
+}
+
+// Add records a decision in the plan. Outside of a dry run it does nothing, so callers
+// can record what they are doing unconditionally.
+func Add(s Step) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if dryRun {
+		steps = append(steps, s)
+	}
+}
+
+// Command records and prints a command that would have been run
+func Command(cmd string, arg ...string) {
+	s := Step{
+		Type:    "command",
+		Command: append([]string{cmd}, arg...),
+	}
+	Add(s)
+	fmt.Println("[dry-run]", s)
+}
+
+// Steps returns everything planned so far
+func Steps() []Step {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return append([]Step{}, steps...)
+}
+
+// WriteJSON writes the plan to w
+func WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(Steps())
+}
+
+func (s Step) String() string {
+	switch s.Type {
+	case "command":
+		return strings.Join(s.Command, " ")
+	case "install":
+		if s.LocalVersion != "" {
+			return fmt.Sprintf("update %s %s -> %s from %s", s.Package, s.LocalVersion, s.RemoteVersion, s.URL)
+		}
+		return fmt.Sprintf("install %s %s from %s", s.Package, s.RemoteVersion, s.URL)
+	case "extract":
+		return fmt.Sprintf("extract %s from %s to %s", s.Member, s.URL, strings.Join(s.Files, ", "))
+	case "up-to-date":
+		return fmt.Sprintf("%s is up to date (local: %s, remote: %s)", s.Package, s.LocalVersion, s.RemoteVersion)
+	}
+
+	if len(s.Files) > 0 {
+		return fmt.Sprintf("%s %s %s: %s", s.Type, s.Package, s.LocalVersion, strings.Join(s.Files, ", "))
+	}
+	return fmt.Sprintf("%s %s %s", s.Type, s.Package, s.LocalVersion)
+}
@@ -0,0 +1,106 @@
+package plan
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// startPlan starts a dry run with an empty plan, ending it when the test finishes
+func startPlan(t *testing.T) {
+	SetDryRun(true)
+	steps = nil
+	t.Cleanup(func() {
+		SetDryRun(false)
+		steps = nil
+	})
+}
+
+func TestAddOutsideDryRun(t *testing.T) {
+	Add(Step{Type: "install", Package: "tool"})
+	Command("true")
+
+	if got := Steps(); len(got) != 0 {
+		t.Errorf("planned %+v outside a dry run", got)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	startPlan(t)
+
+	Command("sudo", "dpkg", "-i", "tool.deb")
+
+	want := []Step{{Type: "command", Command: []string{"sudo", "dpkg", "-i", "tool.deb"}}}
+	if got := Steps(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got := want[0].String(); got != "sudo dpkg -i tool.deb" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	startPlan(t)
+
+	Add(Step{Type: "install", Package: "tool", URL: "https://example.com/tool.tar.gz", LocalVersion: "1.0", RemoteVersion: "1.1"})
+	Add(Step{Type: "extract", Package: "tool", Member: "tool", URL: "https://example.com/tool.tar.gz", Files: []string{"/home/me/bin/tool"}})
+	Command("sudo", "dpkg", "-i", "tool.deb")
+
+	var b bytes.Buffer
+	if err := WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `[
+  {
+    "type": "install",
+    "package": "tool",
+    "url": "https://example.com/tool.tar.gz",
+    "local_version": "1.0",
+    "remote_version": "1.1"
+  },
+  {
+    "type": "extract",
+    "package": "tool",
+    "url": "https://example.com/tool.tar.gz",
+    "member": "tool",
+    "files": [
+      "/home/me/bin/tool"
+    ]
+  },
+  {
+    "type": "command",
+    "command": [
+      "sudo",
+      "dpkg",
+      "-i",
+      "tool.deb"
+    ]
+  }
+]
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+
+	var got []Step
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, Steps()) {
+		t.Errorf("round trip gave %+v, want %+v", got, Steps())
+	}
+}
+
+func TestWriteJSONEmpty(t *testing.T) {
+	startPlan(t)
+
+	var b bytes.Buffer
+	if err := WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != "[]\n" {
+		t.Errorf("got %q, want an empty list", got)
+	}
+}
@@ -0,0 +1,264 @@
+package preflight
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/dooferlad/jat/shell"
+	"github.com/dooferlad/jat/utils"
+	"github.com/dooferlad/jat/zfs"
+)
+
+// procDir is where processes are looked for, a variable so tests can use a fake one
+var procDir = "/proc"
+
+// lookPath finds the tools the checks use, a variable so tests can pretend they exist
+var lookPath = exec.LookPath
+
+// isMe returns true if name is the user running jat, or the one who ran it with sudo
+func isMe(me *user.User, name string) bool {
+	return name == me.Username || (name != "" && name == os.Getenv("SUDO_USER"))
+}
+
+// Users blocks when anyone other than the current user is logged in
+type Users struct{}
+
+func (Users) Name() string { return "users" }
+
+func (Users) Blockers(ctx context.Context, r shell.Runner) ([]string, error) {
+	me, err := user.Current()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := r.Capture(ctx, "who")
+	if err != nil {
+		return nil, err
+	}
+
+	var blockers []string
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || isMe(me, fields[0]) {
+			continue
+		}
+		blockers = append(blockers, fields[0]+" is logged in on "+fields[1])
+	}
+
+	return blockers, nil
+}
+
+// PackageManager blocks while a package manager is running
+type PackageManager struct{}
+
+// packageManagers are the process names of package managers. PackageKit's daemon is left
+// out because it runs all the time.
+var packageManagers = []string{
+	"apt", "apt-get", "aptitude", "dpkg", "unattended-upgr",
+	"dnf", "yum", "rpm",
+	"pacman",
+	"zypper",
+	"snap", "flatpak",
+}
+
+// aptLocks are taken by apt and dpkg while they run. They are held with fcntl locks by
+// processes running as root, so fuser is run with sudo to find out who holds them.
+var aptLocks = []string{
+	"/var/lib/dpkg/lock-frontend",
+	"/var/lib/dpkg/lock",
+	"/var/lib/apt/lists/lock",
+	"/var/cache/apt/archives/lock",
+}
+
+func (PackageManager) Name() string { return "package-manager" }
+
+func (PackageManager) Blockers(ctx context.Context, r shell.Runner) ([]string, error) {
+	comms, err := filepath.Glob(filepath.Join(procDir, "[0-9]*", "comm"))
+	if err != nil {
+		return nil, err
+	}
+
+	var blockers []string
+	for _, comm := range comms {
+		b, err := ioutil.ReadFile(comm)
+		if err != nil {
+			continue // The process has gone
+		}
+		name := strings.TrimSpace(string(b))
+		if utils.InList(name, packageManagers) {
+			pid := filepath.Base(filepath.Dir(comm))
+			blockers = append(blockers, name+" is running (pid "+pid+")")
+		}
+	}
+
+	// pacman leaves its lock file behind while it runs
+	if _, err := os.Stat("/var/lib/pacman/db.lck"); err == nil {
+		blockers = append(blockers, "pacman database is locked")
+	}
+
+	locked, err := heldLocks(ctx, r, aptLocks)
+	blockers = append(blockers, locked...)
+
+	return blockers, err
+}
+
+// heldLocks returns a blocker for each of locks that a process has open. fuser exits 1,
+// silently, when nothing has the file open; sudo failing exits 1 too, but says why.
+func heldLocks(ctx context.Context, r shell.Runner, locks []string) ([]string, error) {
+	var blockers []string
+	for _, lock := range locks {
+		if _, err := os.Stat(lock); err != nil {
+			continue
+		}
+
+		if _, err := lookPath("fuser"); err != nil {
+			return blockers, fmt.Errorf("unable to tell if %s is locked, fuser is not installed", lock)
+		}
+
+		out, err := r.Capture(ctx, "sudo", "fuser", lock)
+		if shell.ExitCode(err) == 1 && len(strings.TrimSpace(string(out))) == 0 {
+			continue
+		}
+		if err != nil {
+			return blockers, fmt.Errorf("checking %s: %s: %s", lock, err, strings.TrimSpace(string(out)))
+		}
+
+		// fuser prints the file name then the pids holding it
+		var pids []string
+		for _, f := range strings.Fields(strings.TrimPrefix(string(out), lock+":")) {
+			if pid := strings.TrimRight(f, "cefFrm"); pid != "" {
+				pids = append(pids, pid)
+			}
+		}
+		blockers = append(blockers, lock+" is locked (pid "+strings.Join(pids, ", ")+")")
+	}
+
+	return blockers, nil
+}
+
+// ZFS blocks while a pool is being scrubbed or resilvered
+type ZFS struct{}
+
+func (ZFS) Name() string { return "zfs" }
+
+func (ZFS) Blockers(ctx context.Context, r shell.Runner) ([]string, error) {
+	if _, err := exec.LookPath("zpool"); err != nil {
+		return nil, nil
+	}
+
+	return zfs.Activity(ctx, r)
+}
+
+// Tmux blocks while other users have tmux sessions, which would be lost. Each user has
+// their own tmux server, so they are found by looking for the servers' processes. The
+// current user's sessions don't count, for the same reason they can be logged in.
+type Tmux struct{}
+
+func (Tmux) Name() string { return "tmux" }
+
+func (Tmux) Blockers(ctx context.Context, r shell.Runner) ([]string, error) {
+	me, err := user.Current()
+	if err != nil {
+		return nil, err
+	}
+
+	comms, err := filepath.Glob(filepath.Join(procDir, "[0-9]*", "comm"))
+	if err != nil {
+		return nil, err
+	}
+
+	var blockers []string
+	for _, comm := range comms {
+		b, err := ioutil.ReadFile(comm)
+		if err != nil || strings.TrimSpace(string(b)) != "tmux: server" {
+			continue
+		}
+
+		dir := filepath.Dir(comm)
+		owner, err := fileOwner(dir)
+		if err != nil {
+			continue // The process has gone
+		}
+		if !isMe(me, owner) {
+			blockers = append(blockers, owner+" has tmux sessions (pid "+filepath.Base(dir)+")")
+		}
+	}
+	return blockers, nil
+}
+
+// fileOwner returns the name of the user that owns path, or their uid if they have no name
+func fileOwner(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", fmt.Errorf("unable to find the owner of %s", path)
+	}
+
+	uid := strconv.FormatUint(uint64(stat.Uid), 10)
+	if u, err := user.LookupId(uid); err == nil {
+		return u.Username, nil
+	}
+	return uid, nil
+}
+
+// Inhibitors blocks when a program has taken a systemd-inhibit block lock on shutdown.
+// Delay locks, like the one unattended-upgrades holds, only hold a shutdown up for a few
+// seconds so they don't count.
+type Inhibitors struct{}
+
+func (Inhibitors) Name() string { return "inhibitors" }
+
+func (Inhibitors) Blockers(ctx context.Context, r shell.Runner) ([]string, error) {
+	if _, err := exec.LookPath("systemd-inhibit"); err != nil {
+		return nil, nil
+	}
+
+	out, err := r.Capture(ctx, "systemd-inhibit", "--list", "--no-pager")
+	if err != nil {
+		return nil, err
+	}
+
+	return blockingInhibitors(string(out)), nil
+}
+
+// blockingInhibitors picks the block mode shutdown locks out of systemd-inhibit --list.
+// WHO and WHY can contain spaces, so WHAT is found by its column in the header and MODE,
+// the last column, is the last field.
+func blockingInhibitors(out string) []string {
+	var blockers []string
+	what, why := -1, -1
+	for _, line := range strings.Split(out, "\n") {
+		row := []rune(line)
+		fields := strings.Fields(line)
+
+		if what < 0 {
+			if len(fields) > 0 && fields[0] == "WHO" {
+				what = strings.Index(line, " WHAT ") + 1
+				why = strings.Index(line, " WHY ") + 1
+			}
+			continue
+		}
+		if len(fields) == 0 || what <= 0 || why <= what || len(row) <= why {
+			continue
+		}
+
+		if fields[len(fields)-1] != "block" {
+			continue
+		}
+		if utils.InList("shutdown", strings.Split(strings.TrimSpace(string(row[what:why])), ":")) {
+			blockers = append(blockers, strings.Join(fields, " "))
+		}
+	}
+	return blockers
+}
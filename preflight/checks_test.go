@@ -0,0 +1,143 @@
+package preflight
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dooferlad/jat/shell"
+)
+
+const inhibitors = `WHO                          UID  USER PID  COMM            WHAT           WHY                                                       MODE
+ModemManager                 0    root 1019 ModemManager    sleep          ModemManager needs to reset devices                       delay
+Unattended Upgrades Shutdown 0    root 1215 unattended-upgr shutdown       Stop ongoing upgrades or perform upgrades before shutdown delay
+GNOME Shell                  1000 me   2345 gnome-shell     sleep          GNOME needs to lock the screen                            delay
+backup                       1000 me   9999 systemd-inhibit shutdown:sleep Backing up home                                           block
+Steam                        1000 me   4242 steam           idle           Downloading a shutdown-sensitive update                   block
+
+5 inhibitors listed.
+`
+
+func TestBlockingInhibitors(t *testing.T) {
+	got := blockingInhibitors(inhibitors)
+	want := []string{"backup 1000 me 9999 systemd-inhibit shutdown:sleep Backing up home block"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if got := blockingInhibitors("No inhibitors.\n"); len(got) != 0 {
+		t.Errorf("got %q with no inhibitors", got)
+	}
+}
+
+func TestHeldLocks(t *testing.T) {
+	dir := t.TempDir()
+	frontend := filepath.Join(dir, "lock-frontend")
+	lists := filepath.Join(dir, "lists-lock")
+	for _, lock := range []string{frontend, lists} {
+		if err := ioutil.WriteFile(lock, nil, 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	missing := filepath.Join(dir, "missing")
+
+	haveFuser(t, true)
+	f := shell.NewFake().
+		On("sudo fuser "+frontend, shell.Response{Output: []byte(frontend + ":  4321\n")}).
+		On("sudo fuser "+lists, shell.Response{ExitCode: 1})
+
+	got, err := heldLocks(context.Background(), f, []string{frontend, lists, missing})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{frontend + " is locked (pid 4321)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if calls := f.Calls(); len(calls) != 2 {
+		t.Errorf("got calls %+v, want fuser run for the two locks that exist", calls)
+	}
+}
+
+// haveFuser pretends fuser is, or isn't, installed
+func haveFuser(t *testing.T, installed bool) {
+	lookPath = func(file string) (string, error) {
+		if installed && file == "fuser" {
+			return "/usr/bin/fuser", nil
+		}
+		return "", exec.ErrNotFound
+	}
+	t.Cleanup(func() { lookPath = exec.LookPath })
+}
+
+func TestHeldLocksFailures(t *testing.T) {
+	lock := filepath.Join(t.TempDir(), "lock")
+	if err := ioutil.WriteFile(lock, nil, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	haveFuser(t, false)
+	if got, err := heldLocks(context.Background(), shell.NewFake(), []string{lock}); err == nil {
+		t.Errorf("got %q without fuser, want an error", got)
+	}
+
+	haveFuser(t, true)
+	f := shell.NewFake().On("sudo fuser "+lock, shell.Response{ExitCode: 1, Output: []byte("sudo: a password is required\n")})
+	if got, err := heldLocks(context.Background(), f, []string{lock}); err == nil {
+		t.Errorf("got %q when sudo failed, want an error", got)
+	}
+}
+
+// fakeProcess adds a process running comm to a temporary /proc
+func fakeProcess(t *testing.T, pid, comm string) string {
+	dir := filepath.Join(procDir, pid)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "comm"), []byte(comm+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestTmux(t *testing.T) {
+	old := procDir
+	procDir = t.TempDir()
+	defer func() { procDir = old }()
+
+	fakeProcess(t, "100", "bash")
+	fakeProcess(t, "200", "tmux: server")
+
+	// The current user's own sessions don't block
+	got, err := Tmux{}.Blockers(context.Background(), shell.NewFake())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("got %q for my own tmux server", got)
+	}
+
+	if os.Geteuid() != 0 {
+		t.Skip("only root can give a process to another user")
+	}
+	other := fakeProcess(t, "300", "tmux: server")
+	if err := os.Chown(other, 65534, 65534); err != nil {
+		t.Fatal(err)
+	}
+	owner, err := fileOwner(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = Tmux{}.Blockers(context.Background(), shell.NewFake())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{owner + " has tmux sessions (pid 300)"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
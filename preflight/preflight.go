@@ -0,0 +1,67 @@
+package preflight
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dooferlad/jat/shell"
+	"github.com/dooferlad/jat/utils"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Check looks for something that should stop the machine being rebooted or shut down
+type Check interface {
+	Name() string
+	// Blockers returns a description of everything that should stop the power action
+	Blockers(ctx context.Context, r shell.Runner) ([]string, error)
+}
+
+// Checks is every check, in the order they are run
+var Checks = []Check{
+	Users{},
+	PackageManager{},
+	ZFS{},
+	Tmux{},
+	Inhibitors{},
+}
+
+// Blocked is returned by Run when something should stop a reboot or shutdown
+type Blocked struct {
+	Action   string
+	Blockers []string
+}
+
+func (b Blocked) Error() string {
+	return fmt.Sprintf("refusing to %s:\n  %s\nuse --force to %s anyway", b.Action, strings.Join(b.Blockers, "\n  "), b.Action)
+}
+
+// Run runs every check not listed in "preflight.skip" in the config file. If any of them
+// find a blocker a Blocked error listing them all is returned. A check that fails to run
+// is logged rather than treated as a blocker.
+func Run(ctx context.Context, r shell.Runner, action string) error {
+	skip := viper.GetStringSlice("preflight.skip")
+
+	var blockers []string
+	for _, c := range Checks {
+		if utils.InList(c.Name(), skip) {
+			continue
+		}
+
+		// A check that fails part way can still have found something
+		b, err := c.Blockers(ctx, r)
+		if err != nil {
+			logrus.Warnf("preflight check %s: %s", c.Name(), err)
+		}
+		for _, blocker := range b {
+			blockers = append(blockers, c.Name()+": "+blocker)
+		}
+	}
+
+	if len(blockers) > 0 {
+		return Blocked{Action: action, Blockers: blockers}
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Status is the outcome of a step
+type Status string
+
+const (
+	Unchanged Status = "unchanged"
+	Updated   Status = "updated"
+	Skipped   Status = "skipped"
+	Failed    Status = "failed"
+)
+
+// Entry is the result of one step of a run, or one package updated by it
+type Entry struct {
+	// Step is the part of the run, e.g. "blob", "packages" or "updater"
+	Step       string        `json:"step"`
+	Name       string        `json:"name"`
+	Status     Status        `json:"status"`
+	OldVersion string        `json:"old_version,omitempty"`
+	NewVersion string        `json:"new_version,omitempty"`
+	Detail     string        `json:"detail,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration_ns"`
+}
+
+// Report collects the results of a run. It is safe to add to from several goroutines.
+type Report struct {
+	mutex   sync.Mutex
+	entries []Entry
+}
+
+// New returns an empty report
+func New() *Report {
+	return &Report{}
+}
+
+// Add records the result of a step. If err isn't nil the step is marked as failed.
+func (r *Report) Add(e Entry, err error) {
+	if err != nil {
+		e.Status = Failed
+		e.Error = err.Error()
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.entries = append(r.entries, e)
+}
+
+// Time runs f, recording how long it took along with its result
+func (r *Report) Time(step, name string, f func() (Entry, error)) {
+	start := time.Now()
+	e, err := f()
+	e.Step = step
+	if e.Name == "" {
+		e.Name = name
+	}
+	e.Duration = time.Since(start)
+	r.Add(e, err)
+}
+
+// Entries returns everything recorded so far
+func (r *Report) Entries() []Entry {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]Entry{}, r.entries...)
+}
+
+// Failures returns the number of steps that failed
+func (r *Report) Failures() int {
+	failed := 0
+	for _, e := range r.Entries() {
+		if e.Status == Failed {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Changed returns true if anything in step was updated
+func (r *Report) Changed(step string) bool {
+	for _, e := range r.Entries() {
+		if e.Step == step && e.Status == Updated {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns an error summarising any failures
+func (r *Report) Err() error {
+	if n := r.Failures(); n > 0 {
+		return fmt.Errorf("%d of %d steps failed", n, len(r.Entries()))
+	}
+	return nil
+}
+
+// CheckFormat returns an error if format isn't one Write understands
+func CheckFormat(format string) error {
+	switch format {
+	case "", "table", "json":
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, expected table or json", format)
+}
+
+// Write prints the report in the given format: "table" or "json"
+func (r *Report) Write(w io.Writer, format string) error {
+	if err := CheckFormat(format); err != nil {
+		return err
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r.Entries())
+	}
+	return r.writeTable(w)
+}
+
+func (r *Report) writeTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tNAME\tSTATUS\tVERSION\tTIME\tDETAIL")
+	for _, e := range r.Entries() {
+		ver := e.OldVersion
+		if e.NewVersion != "" && e.NewVersion != e.OldVersion {
+			ver = e.OldVersion + " -> " + e.NewVersion
+		}
+		detail := e.Detail
+		if e.Error != "" {
+			detail = e.Error
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", e.Step, e.Name, e.Status, ver, e.Duration.Round(time.Millisecond), detail)
+	}
+	return tw.Flush()
+}
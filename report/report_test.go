@@ -0,0 +1,141 @@
+package report
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+// sample is a report with one entry of each status
+func sample() *Report {
+	r := New()
+	r.Add(Entry{Step: "blob", Name: "helm", Status: Updated, OldVersion: "3.7.1", NewVersion: "3.7.2", Detail: "https://example.com/helm.tar.gz", Duration: 1500 * time.Millisecond}, nil)
+	r.Add(Entry{Step: "blob", Name: "kubectl", Status: Unchanged, OldVersion: "1.23.0", NewVersion: "1.23.0", Duration: 250 * time.Millisecond}, nil)
+	r.Add(Entry{Step: "updater", Name: "flatpak", Duration: time.Second}, errors.New("exit status 1"))
+	r.Add(Entry{Step: "restart", Name: "cron.service", Status: Skipped, Detail: "needs restart: denied"}, nil)
+	return r
+}
+
+func TestWriteTable(t *testing.T) {
+	var b bytes.Buffer
+	if err := sample().Write(&b, "table"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `STEP     NAME          STATUS     VERSION         TIME   DETAIL
+blob     helm          updated    3.7.1 -> 3.7.2  1.5s   https://example.com/helm.tar.gz
+blob     kubectl       unchanged  1.23.0          250ms  
+updater  flatpak       failed                     1s     exit status 1
+restart  cron.service  skipped                    0s     needs restart: denied
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+
+	// Table is the default
+	var d bytes.Buffer
+	if err := sample().Write(&d, ""); err != nil {
+		t.Fatal(err)
+	}
+	if d.String() != want {
+		t.Errorf("default format gave\n%s", d.String())
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var b bytes.Buffer
+	if err := sample().Write(&b, "json"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `[
+  {
+    "step": "blob",
+    "name": "helm",
+    "status": "updated",
+    "old_version": "3.7.1",
+    "new_version": "3.7.2",
+    "detail": "https://example.com/helm.tar.gz",
+    "duration_ns": 1500000000
+  },
+  {
+    "step": "blob",
+    "name": "kubectl",
+    "status": "unchanged",
+    "old_version": "1.23.0",
+    "new_version": "1.23.0",
+    "duration_ns": 250000000
+  },
+  {
+    "step": "updater",
+    "name": "flatpak",
+    "status": "failed",
+    "error": "exit status 1",
+    "duration_ns": 1000000000
+  },
+  {
+    "step": "restart",
+    "name": "cron.service",
+    "status": "skipped",
+    "detail": "needs restart: denied",
+    "duration_ns": 0
+  }
+]
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestWriteUnknownFormat(t *testing.T) {
+	var b bytes.Buffer
+	if err := sample().Write(&b, "yaml"); err == nil {
+		t.Error("wrote a yaml report")
+	}
+	if b.Len() != 0 {
+		t.Errorf("wrote %q for an unknown format", b.String())
+	}
+}
+
+func TestErr(t *testing.T) {
+	r := New()
+	if err := r.Err(); err != nil {
+		t.Errorf("empty report: %s", err)
+	}
+
+	r.Add(Entry{Step: "blob", Name: "helm", Status: Updated}, nil)
+	if err := r.Err(); err != nil {
+		t.Errorf("no failures: %s", err)
+	}
+
+	r.Add(Entry{Step: "blob", Name: "kubectl"}, errors.New("download failed"))
+	r.Add(Entry{Step: "updater", Name: "snap", Status: Failed}, nil)
+	if r.Failures() != 2 {
+		t.Errorf("got %d failures, want 2", r.Failures())
+	}
+	if err := r.Err(); err == nil || err.Error() != "2 of 3 steps failed" {
+		t.Errorf("got %v, want 2 of 3 steps failed", err)
+	}
+}
+
+func TestChanged(t *testing.T) {
+	r := sample()
+	for step, want := range map[string]bool{"blob": true, "updater": false, "restart": false, "packages": false} {
+		if got := r.Changed(step); got != want {
+			t.Errorf("Changed(%q) = %v, want %v", step, got, want)
+		}
+	}
+}
+
+func TestTime(t *testing.T) {
+	r := New()
+	r.Time("snapshot", "rpool@jat", func() (Entry, error) {
+		return Entry{Status: Updated}, nil
+	})
+
+	e := r.Entries()[0]
+	if e.Step != "snapshot" || e.Name != "rpool@jat" || e.Status != Updated {
+		t.Errorf("got %+v", e)
+	}
+}
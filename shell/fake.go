@@ -0,0 +1,117 @@
+package shell
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// Call is a command run through a Fake
+type Call struct {
+	Root    bool
+	Capture bool
+	Stream  bool
+	Command []string
+}
+
+// Response is what a Fake returns for a command
+type Response struct {
+	Output   []byte
+	ExitCode int
+	Err      error
+}
+
+// Fake is a Runner that doesn't run anything. It records every call and answers with
+// canned responses, looked up by the command line (including "sudo" for Sudo).
+type Fake struct {
+	mutex     sync.Mutex
+	calls     []Call
+	responses map[string]Response
+	// Default is returned for commands without a scripted response
+	Default Response
+}
+
+// NewFake returns a Fake that succeeds, with no output, for every command
+func NewFake() *Fake {
+	return &Fake{
+		responses: map[string]Response{},
+	}
+}
+
+// On scripts the response to a command line such as "sudo pkcon refresh"
+func (f *Fake) On(commandLine string, r Response) *Fake {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.responses[commandLine] = r
+	return f
+}
+
+// Calls returns the commands run so far, in order
+func (f *Fake) Calls() []Call {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return append([]Call{}, f.calls...)
+}
+
+// CommandLines returns the commands run so far as command lines, in order, in the form On
+// expects
+func (f *Fake) CommandLines() []string {
+	var lines []string
+	for _, c := range f.Calls() {
+		lines = append(lines, strings.Join(c.Command, " "))
+	}
+	return lines
+}
+
+// Run records the command and returns its scripted error
+func (f *Fake) Run(ctx context.Context, cmd string, arg ...string) error {
+	_, err := f.call(Call{Command: append([]string{cmd}, arg...)})
+	return err
+}
+
+// Sudo records the command and returns its scripted error
+func (f *Fake) Sudo(ctx context.Context, cmd string, arg ...string) error {
+	_, err := f.call(Call{Root: true, Command: append([]string{"sudo", cmd}, arg...)})
+	return err
+}
+
+// Capture records the command and returns its scripted output and error
+func (f *Fake) Capture(ctx context.Context, cmd string, arg ...string) ([]byte, error) {
+	return f.call(Call{Capture: true, Command: append([]string{cmd}, arg...)})
+}
+
+// Stream records the command, passes each line of its scripted output to line as "stdout",
+// then returns its scripted error
+func (f *Fake) Stream(ctx context.Context, line func(stream, text string), cmd string, arg ...string) error {
+	out, err := f.call(Call{Stream: true, Command: append([]string{cmd}, arg...)})
+	text := strings.TrimSuffix(string(out), "\n")
+	if text != "" {
+		for _, l := range strings.Split(text, "\n") {
+			line("stdout", l)
+		}
+	}
+	return err
+}
+
+func (f *Fake) call(c Call) ([]byte, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.calls = append(f.calls, c)
+
+	r, ok := f.responses[strings.Join(c.Command, " ")]
+	if !ok {
+		r = f.Default
+	}
+
+	if r.Err != nil {
+		return r.Output, r.Err
+	}
+	if r.ExitCode != 0 {
+		return r.Output, &ExitError{Code: r.ExitCode}
+	}
+
+	return r.Output, nil
+}
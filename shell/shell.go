@@ -1,22 +1,60 @@
 package shell
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
 	"sync"
+
+	"github.com/dooferlad/jat/plan"
+	"github.com/dooferlad/jat/utils"
 )
 
-var mutex sync.Mutex
+// Runner runs external commands. Exec runs them for real; Fake is scripted for tests.
+type Runner interface {
+	// Run runs a command in the user's environment, connected to the terminal
+	Run(ctx context.Context, cmd string, arg ...string) error
+	// Sudo runs a command prefixed by sudo
+	Sudo(ctx context.Context, cmd string, arg ...string) error
+	// Capture runs a command, returning its combined output
+	Capture(ctx context.Context, cmd string, arg ...string) ([]byte, error)
+	// Stream runs a command, calling line with each line it writes to "stdout" or "stderr"
+	// as it is written, until the command exits
+	Stream(ctx context.Context, line func(stream, text string), cmd string, arg ...string) error
+}
+
+// Exec is a Runner backed by os/exec. Commands connected to the terminal are run one at a
+// time so that their output isn't interleaved.
+type Exec struct {
+	mutex sync.Mutex
+}
 
-// Shell Run a command in the user's environment
-func Shell(cmd string, arg ...string) error {
-	mutex.Lock()
-	defer mutex.Unlock()
+// NewExec returns a Runner that runs real commands
+func NewExec() *Exec {
+	return &Exec{}
+}
+
+// Run a command in the user's environment. It is killed if ctx is cancelled or the
+// "command" timeout expires.
+func (e *Exec) Run(ctx context.Context, cmd string, arg ...string) error {
+	if plan.DryRun() {
+		plan.Command(cmd, arg...)
+		return nil
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	ctx, cancel := utils.WithTimeout(ctx, "command")
+	defer cancel()
 
 	fmt.Println(cmd, strings.Join(arg, " "))
-	exe := exec.Command(cmd, arg...)
+	exe := exec.CommandContext(ctx, cmd, arg...)
 	exe.Env = os.Environ()
 	exe.Stderr = os.Stderr
 	exe.Stdout = os.Stdout
@@ -30,18 +68,115 @@ func Shell(cmd string, arg ...string) error {
 }
 
 // Sudo Run a shell command prefixed by sudo, return error
-func Sudo(cmd string, arg ...string) error {
-	c := []string{cmd}
-	c = append(c, arg...)
+func (e *Exec) Sudo(ctx context.Context, cmd string, arg ...string) error {
+	return e.Run(ctx, "sudo", append([]string{cmd}, arg...)...)
+}
+
+// operationKey is the context key for the timeout Capture applies
+type operationKey struct{}
 
-	return Shell("sudo", c...)
+// WithOperation returns a context that makes Capture apply the timeout for operation rather
+// than the "capture" timeout, for captured commands that can take a long time
+func WithOperation(ctx context.Context, operation string) context.Context {
+	return context.WithValue(ctx, operationKey{}, operation)
 }
 
-// Capture Run a command in the user's environment capturing the output
-func Capture(cmd string, arg ...string) ([]byte, error) {
-	exe := exec.Command(cmd, arg...)
+// Capture Run a command in the user's environment capturing the output. It is killed if
+// ctx is cancelled or the "capture" timeout, or the one set by WithOperation, expires.
+func (e *Exec) Capture(ctx context.Context, cmd string, arg ...string) ([]byte, error) {
+	operation, ok := ctx.Value(operationKey{}).(string)
+	if !ok {
+		operation = "capture"
+	}
+	ctx, cancel := utils.WithTimeout(ctx, operation)
+	defer cancel()
+
+	exe := exec.CommandContext(ctx, cmd, arg...)
 	exe.Env = os.Environ()
 
 	out, err := exe.CombinedOutput()
 	return out, err
 }
+
+// Stream runs a command in the user's environment, passing each line of its output to
+// line as it arrives. Calls to line are never concurrent. There is no timeout: it is meant
+// for commands, like journalctl -f, that run until they are stopped by cancelling ctx.
+func (e *Exec) Stream(ctx context.Context, line func(stream, text string), cmd string, arg ...string) error {
+	exe := exec.CommandContext(ctx, cmd, arg...)
+	exe.Env = os.Environ()
+
+	stdout, err := exe.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := exe.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := exe.Start(); err != nil {
+		return err
+	}
+
+	var lineMutex sync.Mutex
+	var wg sync.WaitGroup
+	var scanErr error
+	scan := func(stream string, r io.Reader) {
+		defer wg.Done()
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			lineMutex.Lock()
+			line(stream, scanner.Text())
+			lineMutex.Unlock()
+		}
+
+		// A line too long for the buffer stops the scanner. The rest of the output is
+		// thrown away so the command doesn't block writing to a full pipe.
+		if err := scanner.Err(); err != nil {
+			lineMutex.Lock()
+			scanErr = fmt.Errorf("reading %s of %s: %s", stream, cmd, err)
+			lineMutex.Unlock()
+			io.Copy(io.Discard, r)
+		}
+	}
+	wg.Add(2)
+	go scan("stdout", stdout)
+	go scan("stderr", stderr)
+
+	// The pipes must be read to the end before Wait closes them
+	wg.Wait()
+	if err := exe.Wait(); err != nil {
+		return err
+	}
+	return scanErr
+}
+
+// ExitError is returned by Fake for commands scripted to exit with a non-zero code
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ExitCode returns the exit code
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// ExitCode returns the exit code of the command that returned err: 0 for no error, -1 if
+// err didn't come from a command exiting
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var e interface{ ExitCode() int }
+	if errors.As(err, &e) {
+		return e.ExitCode()
+	}
+
+	return -1
+}
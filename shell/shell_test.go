@@ -0,0 +1,66 @@
+package shell
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestStream(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var got []string
+	err := NewExec().Stream(ctx, func(stream, text string) {
+		got = append(got, stream+": "+text)
+	}, "sh", "-c", "echo out; echo err >&2; exit 3")
+
+	if ExitCode(err) != 3 {
+		t.Errorf("got %v, want exit status 3", err)
+	}
+	// The two streams are read concurrently, so only the lines are checked, not their order
+	if len(got) != 2 || (got[0] != "stdout: out" && got[1] != "stdout: out") {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestStreamLongLine(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// A 2MB line is more than the scanner holds, and more than a pipe buffers, so the
+	// command only finishes if the rest of its output is drained
+	var got []string
+	err := NewExec().Stream(ctx, func(stream, text string) {
+		got = append(got, text)
+	}, "sh", "-c", "echo before; head -c 2000000 /dev/zero | tr '\\000' a; echo; echo after")
+
+	if ctx.Err() != nil {
+		t.Fatal("Stream didn't return before the timeout")
+	}
+	if err == nil {
+		t.Error("the overlong line wasn't reported")
+	}
+	if want := []string{"before"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCaptureOperationTimeout(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("timeouts.capture", "50ms")
+
+	ctx := context.Background()
+	if _, err := NewExec().Capture(ctx, "sleep", "1"); err == nil {
+		t.Error("sleep outlived the capture timeout")
+	}
+
+	// Watched commands have no limit by default
+	if out, err := NewExec().Capture(WithOperation(ctx, "watch"), "sleep", "0.2"); err != nil {
+		t.Errorf("got %v: %s", err, out)
+	}
+}
@@ -0,0 +1,165 @@
+package state
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+var mutex sync.Mutex
+
+// Record describes a single install of a binary package
+type Record struct {
+	Name        string
+	Action      string
+	Version     string
+	PackageType string `json:",omitempty"`
+	DownloadURL string
+	Checksum    string
+	Files       []string `json:",omitempty"`
+	Time        time.Time
+}
+
+// State is everything jat remembers about the packages it has installed
+type State struct {
+	Packages map[string]Record
+	History  []Record
+}
+
+// Path returns the location of the state file, following the XDG base directory spec
+func Path() (string, error) {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+
+	return filepath.Join(dir, "jat", "state.json"), nil
+}
+
+// Load reads the state file. A missing file is an empty state, not an error.
+func Load() (*State, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	return load()
+}
+
+// Update loads the state, applies f to it and, if f doesn't return an error, saves it
+func Update(f func(s *State) error) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	s, err := load()
+	if err != nil {
+		return err
+	}
+
+	if err := f(s); err != nil {
+		return err
+	}
+
+	return save(s)
+}
+
+// Add stores r as the current install of r.Name and appends it to the history
+func (s *State) Add(r Record) {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	s.Packages[r.Name] = r
+	s.History = append(s.History, r)
+}
+
+// Remove forgets the current install of name, recording its removal in the history
+func (s *State) Remove(name string) {
+	r := s.Packages[name]
+	delete(s.Packages, name)
+
+	s.History = append(s.History, Record{
+		Name:        name,
+		Action:      "uninstall",
+		Version:     r.Version,
+		PackageType: r.PackageType,
+		Files:       r.Files,
+		Time:        time.Now(),
+	})
+}
+
+// Get returns the current install of name
+func (s *State) Get(name string) (Record, bool) {
+	r, ok := s.Packages[name]
+	return r, ok
+}
+
+// Names returns the names of all installed packages, sorted
+func (s *State) Names() []string {
+	var names []string
+	for name := range s.Packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func load() (*State, error) {
+	s := State{
+		Packages: map[string]Record{},
+	}
+
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &s, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+
+	if s.Packages == nil {
+		s.Packages = map[string]Record{}
+	}
+
+	return &s, nil
+}
+
+func save(s *State) error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write then rename so an interrupted run can't leave a truncated file behind
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,159 @@
+package state
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+func setenv(t *testing.T, key, value string) {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestPath(t *testing.T) {
+	dir := t.TempDir()
+
+	setenv(t, "XDG_STATE_HOME", filepath.Join(dir, "xdg"))
+	if got, err := Path(); err != nil || got != filepath.Join(dir, "xdg", "jat", "state.json") {
+		t.Errorf("with XDG_STATE_HOME got %q, %v", got, err)
+	}
+
+	// homedir caches the home directory, which would hide the change to HOME
+	homedir.DisableCache = true
+	defer func() { homedir.DisableCache = false }()
+	setenv(t, "XDG_STATE_HOME", "")
+	setenv(t, "HOME", filepath.Join(dir, "home"))
+	if got, err := Path(); err != nil || got != filepath.Join(dir, "home", ".local", "state", "jat", "state.json") {
+		t.Errorf("without XDG_STATE_HOME got %q, %v", got, err)
+	}
+}
+
+func TestLoadMissing(t *testing.T) {
+	setenv(t, "XDG_STATE_HOME", t.TempDir())
+
+	s, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Packages) != 0 || len(s.History) != 0 {
+		t.Errorf("got %+v, want an empty state", s)
+	}
+	if _, ok := s.Get("tool"); ok {
+		t.Error("found a package in an empty state")
+	}
+}
+
+func TestUpdateRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	setenv(t, "XDG_STATE_HOME", dir)
+
+	installed := time.Date(2021, 12, 18, 10, 0, 0, 0, time.UTC)
+	tool := Record{
+		Name:        "tool",
+		Action:      "install",
+		Version:     "1.2.0",
+		DownloadURL: "https://example.com/tool-1.2.0.tar.gz",
+		Files:       []string{"/home/me/bin/tool"},
+		Time:        installed,
+	}
+	deb := Record{Name: "deb-tool", Action: "install", Version: "2.0", PackageType: "deb", Time: installed}
+
+	if err := Update(func(s *State) error {
+		s.Add(tool)
+		s.Add(deb)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := s.Get("tool"); !ok || !reflect.DeepEqual(got, tool) {
+		t.Errorf("got %+v, %t, want %+v", got, ok, tool)
+	}
+	if got := s.Names(); !reflect.DeepEqual(got, []string{"deb-tool", "tool"}) {
+		t.Errorf("got names %q", got)
+	}
+
+	if err := Update(func(s *State) error {
+		s.Remove("tool")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Get("tool"); ok {
+		t.Error("tool is still installed after Remove")
+	}
+	if len(s.History) != 3 {
+		t.Fatalf("got history %+v, want install, install, uninstall", s.History)
+	}
+	if removed := s.History[2]; removed.Action != "uninstall" || removed.Version != "1.2.0" || !reflect.DeepEqual(removed.Files, tool.Files) {
+		t.Errorf("got %+v, want the uninstall of tool 1.2.0 with its files", removed)
+	}
+
+	// The save is a write and rename, so nothing is left beside the state file
+	entries, err := ioutil.ReadDir(filepath.Join(dir, "jat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "state.json" {
+		t.Errorf("got %d files in the state directory, want just state.json", len(entries))
+	}
+}
+
+func TestUpdateErrorDoesNotSave(t *testing.T) {
+	setenv(t, "XDG_STATE_HOME", t.TempDir())
+
+	failed := errors.New("failed")
+	err := Update(func(s *State) error {
+		s.Add(Record{Name: "tool", Version: "1.0"})
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("got %v, want the error from f", err)
+	}
+
+	s, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Get("tool"); ok {
+		t.Error("the state was saved even though f failed")
+	}
+}
+
+func TestLoadCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	setenv(t, "XDG_STATE_HOME", dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "jat"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "jat", "state.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(); err == nil {
+		t.Error("a truncated state file loaded without an error")
+	}
+}
@@ -0,0 +1,95 @@
+package updaters
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/dooferlad/jat/plan"
+	"github.com/dooferlad/jat/shell"
+	"github.com/sirupsen/logrus"
+)
+
+// fwupdNothingToDo is the exit code fwupdmgr uses when metadata is already up to date or
+// there are no updates
+const fwupdNothingToDo = 2
+
+// fwupdInteractiveFlags mark devices that need someone to do something, such as pressing a
+// button to put the device in bootloader mode, so can't be updated unattended
+var fwupdInteractiveFlags = []string{
+	"needs-activation",
+	"needs-bootloader",
+	"needs-shutdown",
+}
+
+// Fwupd installs firmware updates with fwupdmgr
+type Fwupd struct{}
+
+type fwupdDevice struct {
+	Name          string
+	DeviceId      string
+	Version       string
+	Flags         []string
+	UpdateMessage string
+	Releases      []struct {
+		Version string
+	}
+}
+
+func (Fwupd) Name() string { return "fwupd" }
+
+func (Fwupd) Update(ctx context.Context, r shell.Runner) ([]string, error) {
+	if err := r.Sudo(ctx, "fwupdmgr", "refresh"); err != nil && shell.ExitCode(err) != fwupdNothingToDo {
+		return nil, fmt.Errorf("refreshing firmware metadata: %s", err)
+	}
+
+	out, err := r.Capture(ctx, "fwupdmgr", "get-updates", "--json")
+	if shell.ExitCode(err) == fwupdNothingToDo {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listing firmware updates: %s: %s", err, out)
+	}
+
+	var updates struct {
+		Devices []fwupdDevice
+	}
+	if err := json.Unmarshal(out, &updates); err != nil {
+		return nil, fmt.Errorf("reading firmware updates: %s", err)
+	}
+
+	var changed []string
+	for _, d := range updates.Devices {
+		if len(d.Releases) == 0 {
+			continue
+		}
+
+		if d.interactive() {
+			logrus.Warnf("fwupd: %s needs interaction to update to %s, run fwupdmgr update by hand", d.Name, d.Releases[0].Version)
+			continue
+		}
+
+		if plan.DryRun() {
+			plan.Command("sudo", "fwupdmgr", "update", "--assume-yes", "--no-reboot-check", d.DeviceId)
+		} else if err := r.Sudo(ctx, "fwupdmgr", "update", "--assume-yes", "--no-reboot-check", d.DeviceId); err != nil {
+			return changed, fmt.Errorf("updating %s: %s", d.Name, err)
+		}
+		changed = append(changed, fmt.Sprintf("%s %s -> %s", d.Name, d.Version, d.Releases[0].Version))
+	}
+
+	return changed, nil
+}
+
+func (d fwupdDevice) interactive() bool {
+	if d.UpdateMessage != "" {
+		return true
+	}
+	for _, f := range d.Flags {
+		for _, i := range fwupdInteractiveFlags {
+			if f == i {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package updaters
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/dooferlad/jat/plan"
+	"github.com/dooferlad/jat/shell"
+)
+
+const fwupdUpdates = `{
+  "Devices": [
+    {
+      "Name": "System Firmware",
+      "DeviceId": "a45df35ac0e948ee180fe216a5f703f32dda163f",
+      "Version": "0.1.10",
+      "Flags": ["internal", "updatable", "require-ac"],
+      "Releases": [{"Version": "0.1.11"}]
+    },
+    {
+      "Name": "Unifying Receiver",
+      "DeviceId": "6e5d3f1e3d1c1b5a3b1e0f0ab43bca8fd1b5a8f1",
+      "Version": "RQR12.01_B0032",
+      "Flags": ["updatable", "needs-bootloader"],
+      "Releases": [{"Version": "RQR12.10_B0032"}]
+    },
+    {
+      "Name": "Thunderbolt Controller",
+      "DeviceId": "2c2ab5b5e8f1c0e1f0f3a7d2e0b6c1c9a3e2d8f7",
+      "Version": "20.00",
+      "Flags": ["updatable"],
+      "Releases": []
+    }
+  ]
+}`
+
+func TestFwupd(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		responses map[string]shell.Response
+		changed   []string
+		commands  []string
+		fails     bool
+	}{
+		{
+			name: "updates",
+			responses: map[string]shell.Response{
+				"fwupdmgr get-updates --json": {Output: []byte(fwupdUpdates)},
+			},
+			changed: []string{"System Firmware 0.1.10 -> 0.1.11"},
+			commands: []string{
+				"sudo fwupdmgr refresh",
+				"fwupdmgr get-updates --json",
+				"sudo fwupdmgr update --assume-yes --no-reboot-check a45df35ac0e948ee180fe216a5f703f32dda163f",
+			},
+		},
+		{
+			name: "metadata up to date",
+			responses: map[string]shell.Response{
+				"sudo fwupdmgr refresh":       {ExitCode: 2},
+				"fwupdmgr get-updates --json": {Output: []byte(fwupdUpdates)},
+			},
+			changed: []string{"System Firmware 0.1.10 -> 0.1.11"},
+			commands: []string{
+				"sudo fwupdmgr refresh",
+				"fwupdmgr get-updates --json",
+				"sudo fwupdmgr update --assume-yes --no-reboot-check a45df35ac0e948ee180fe216a5f703f32dda163f",
+			},
+		},
+		{
+			name: "no updates",
+			responses: map[string]shell.Response{
+				"sudo fwupdmgr refresh":       {ExitCode: 2},
+				"fwupdmgr get-updates --json": {ExitCode: 2, Output: []byte("No updatable devices\n")},
+			},
+			commands: []string{
+				"sudo fwupdmgr refresh",
+				"fwupdmgr get-updates --json",
+			},
+		},
+		{
+			name: "refresh fails",
+			responses: map[string]shell.Response{
+				"sudo fwupdmgr refresh": {ExitCode: 1},
+			},
+			commands: []string{"sudo fwupdmgr refresh"},
+			fails:    true,
+		},
+		{
+			name: "listing fails",
+			responses: map[string]shell.Response{
+				"fwupdmgr get-updates --json": {ExitCode: 1, Output: []byte("Failed to connect to daemon\n")},
+			},
+			commands: []string{
+				"sudo fwupdmgr refresh",
+				"fwupdmgr get-updates --json",
+			},
+			fails: true,
+		},
+		{
+			name: "update fails",
+			responses: map[string]shell.Response{
+				"fwupdmgr get-updates --json": {Output: []byte(fwupdUpdates)},
+				"sudo fwupdmgr update --assume-yes --no-reboot-check a45df35ac0e948ee180fe216a5f703f32dda163f": {ExitCode: 1},
+			},
+			commands: []string{
+				"sudo fwupdmgr refresh",
+				"fwupdmgr get-updates --json",
+				"sudo fwupdmgr update --assume-yes --no-reboot-check a45df35ac0e948ee180fe216a5f703f32dda163f",
+			},
+			fails: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			f := shell.NewFake()
+			for commandLine, r := range test.responses {
+				f.On(commandLine, r)
+			}
+
+			changed, err := Fwupd{}.Update(context.Background(), f)
+			if (err != nil) != test.fails {
+				t.Fatalf("got error %v, want failure %t", err, test.fails)
+			}
+			if !reflect.DeepEqual(changed, test.changed) {
+				t.Errorf("got changed %q, want %q", changed, test.changed)
+			}
+			if got := f.CommandLines(); !reflect.DeepEqual(got, test.commands) {
+				t.Errorf("got commands %q, want %q", got, test.commands)
+			}
+		})
+	}
+}
+
+func TestFwupdDryRun(t *testing.T) {
+	plan.SetDryRun(true)
+	defer plan.SetDryRun(false)
+	before := len(plan.Steps())
+
+	f := shell.NewFake().On("fwupdmgr get-updates --json", shell.Response{Output: []byte(fwupdUpdates)})
+	changed, err := Fwupd{}.Update(context.Background(), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"System Firmware 0.1.10 -> 0.1.11"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("got changed %q, want %q", changed, want)
+	}
+	if want := []string{"sudo fwupdmgr refresh", "fwupdmgr get-updates --json"}; !reflect.DeepEqual(f.CommandLines(), want) {
+		t.Errorf("ran %q in a dry run, want %q", f.CommandLines(), want)
+	}
+
+	want := []plan.Step{{Type: "command", Command: []string{"sudo", "fwupdmgr", "update", "--assume-yes", "--no-reboot-check", "a45df35ac0e948ee180fe216a5f703f32dda163f"}}}
+	if got := plan.Steps()[before:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("planned %+v, want %+v", got, want)
+	}
+}
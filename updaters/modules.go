@@ -0,0 +1,176 @@
+package updaters
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/dooferlad/jat/shell"
+	"github.com/dooferlad/jat/utils"
+)
+
+// matches returns the first capture group of every match of re in out
+func matches(re *regexp.Regexp, out []byte) []string {
+	var found []string
+	for _, m := range re.FindAllSubmatch(out, -1) {
+		found = append(found, string(m[1]))
+	}
+	return found
+}
+
+// Flatpak updates flatpak applications and runtimes
+type Flatpak struct{}
+
+// flatpakRef matches the numbered rows of the table flatpak prints before updating
+var flatpakRef = regexp.MustCompile(`(?m)^\s*\d+\.\s+(?:\S+\s+)?(\S+\.\S+)\s`)
+
+func (Flatpak) Name() string { return "flatpak" }
+
+func (Flatpak) Update(ctx context.Context, r shell.Runner) ([]string, error) {
+	out, err := capture(ctx, r, "flatpak", "update", "--noninteractive", "--assumeyes")
+	if err != nil {
+		return nil, err
+	}
+	return matches(flatpakRef, out), nil
+}
+
+// Snap refreshes snaps
+type Snap struct{}
+
+var snapRefreshed = regexp.MustCompile(`(?m)^(\S+ \S+) from .* refreshed$`)
+
+func (Snap) Name() string { return "snap" }
+
+func (Snap) Update(ctx context.Context, r shell.Runner) ([]string, error) {
+	out, err := capture(ctx, r, "sudo", "snap", "refresh")
+	if err != nil {
+		return nil, err
+	}
+	return matches(snapRefreshed, out), nil
+}
+
+// Rustup updates installed Rust toolchains and rustup itself
+type Rustup struct{}
+
+var rustupUpdated = regexp.MustCompile(`(?m)^\s*(\S+ (?:updated|installed) - .*)$`)
+
+func (Rustup) Name() string { return "rustup" }
+
+func (Rustup) Update(ctx context.Context, r shell.Runner) ([]string, error) {
+	out, err := capture(ctx, r, "rustup", "update")
+	if err != nil {
+		return nil, err
+	}
+	return matches(rustupUpdated, out), nil
+}
+
+// Pipx upgrades applications installed with pipx
+type Pipx struct{}
+
+var pipxUpgraded = regexp.MustCompile(`(?m)upgraded package (\S+ from \S+ to \S+)`)
+
+func (Pipx) Name() string { return "pipx" }
+
+func (Pipx) Update(ctx context.Context, r shell.Runner) ([]string, error) {
+	out, err := capture(ctx, r, "pipx", "upgrade-all")
+	if err != nil {
+		return nil, err
+	}
+	return matches(pipxUpgraded, out), nil
+}
+
+// Npm updates globally installed npm packages
+type Npm struct{}
+
+var npmChanged = regexp.MustCompile(`(?m)((?:added|changed|removed) \d+ packages?)`)
+
+func (Npm) Name() string { return "npm" }
+
+func (Npm) Update(ctx context.Context, r shell.Runner) ([]string, error) {
+	out, err := capture(ctx, r, "npm", "update", "--global")
+	if err != nil {
+		return nil, err
+	}
+	return matches(npmChanged, out), nil
+}
+
+// Go reinstalls binaries with go install. A binary counts as changed if go install
+// replaced it with a different one. A package that fails to install doesn't stop the rest.
+type Go struct {
+	Packages []string
+}
+
+var goMajorVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+func (Go) Name() string { return "go" }
+
+func (g Go) Update(ctx context.Context, r shell.Runner) ([]string, error) {
+	bin, err := goBin(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed, failed []string
+	for _, pkg := range g.Packages {
+		if ctx.Err() != nil {
+			return changed, ctx.Err()
+		}
+
+		binary := filepath.Join(bin, goBinaryName(pkg))
+		before, _ := utils.FileSHA256(binary)
+
+		if _, err := capture(ctx, r, "go", "install", pkg); err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%s)", pkg, err))
+			continue
+		}
+
+		if after, _ := utils.FileSHA256(binary); after != before {
+			changed = append(changed, pkg)
+		}
+	}
+
+	if len(failed) > 0 {
+		return changed, fmt.Errorf("go install failed for %s", strings.Join(failed, ", "))
+	}
+	return changed, nil
+}
+
+// goBin returns the directory go install writes binaries to
+func goBin(ctx context.Context, r shell.Runner) (string, error) {
+	if bin := os.Getenv("GOBIN"); bin != "" {
+		return bin, nil
+	}
+
+	out, err := r.Capture(ctx, "go", "env", "GOBIN", "GOPATH")
+	if err != nil {
+		return "", err
+	}
+
+	// One line each for GOBIN, which is usually empty, and GOPATH
+	lines := strings.SplitN(string(out), "\n", 3)
+	if len(lines) < 2 {
+		return "", fmt.Errorf("unexpected output from go env: %s", out)
+	}
+	if bin := strings.TrimSpace(lines[0]); bin != "" {
+		return bin, nil
+	}
+	gopath := strings.TrimSpace(lines[1])
+	return filepath.Join(filepath.SplitList(gopath)[0], "bin"), nil
+}
+
+// goBinaryName works out the name go install gives the binary for a package path,
+// skipping a major version suffix: example.com/cmd/foo/v2@latest installs foo
+func goBinaryName(pkg string) string {
+	if i := strings.Index(pkg, "@"); i >= 0 {
+		pkg = pkg[:i]
+	}
+	name := path.Base(pkg)
+	if goMajorVersion.MatchString(name) {
+		name = path.Base(path.Dir(pkg))
+	}
+	return name
+}
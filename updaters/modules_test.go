@@ -0,0 +1,51 @@
+package updaters
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dooferlad/jat/shell"
+)
+
+func TestGoCarriesOnAfterFailure(t *testing.T) {
+	old, ok := os.LookupEnv("GOBIN")
+	os.Setenv("GOBIN", t.TempDir())
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv("GOBIN", old)
+		} else {
+			os.Unsetenv("GOBIN")
+		}
+	})
+
+	f := shell.NewFake().On("go install example.com/broken@latest", shell.Response{ExitCode: 1})
+	g := Go{Packages: []string{"example.com/broken@latest", "example.com/tool@latest"}}
+
+	_, err := g.Update(context.Background(), f)
+	if err == nil || !strings.Contains(err.Error(), "example.com/broken@latest") {
+		t.Errorf("got error %v, want one naming the broken package", err)
+	}
+
+	want := []string{
+		"go install example.com/broken@latest",
+		"go install example.com/tool@latest",
+	}
+	if got := f.CommandLines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestGoBinaryName(t *testing.T) {
+	for pkg, want := range map[string]string{
+		"golang.org/x/tools/gopls@latest": "gopls",
+		"example.com/cmd/foo/v2@latest":   "foo",
+		"github.com/owner/tool/cmd/tool":  "tool",
+	} {
+		if got := goBinaryName(pkg); got != want {
+			t.Errorf("goBinaryName(%q) = %q, want %q", pkg, got, want)
+		}
+	}
+}
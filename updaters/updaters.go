@@ -0,0 +1,126 @@
+package updaters
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dooferlad/jat/plan"
+	"github.com/dooferlad/jat/shell"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Config picks which updaters run. It is read from "updaters" in the config file.
+type Config struct {
+	Flatpak bool
+	Snap    bool
+	Rustup  bool
+	Pipx    bool
+	Npm     bool
+	// Fwupd installs firmware updates that don't need anyone to press buttons
+	Fwupd bool
+	// Go lists packages to reinstall with go install, e.g. golang.org/x/tools/gopls@latest
+	Go []string
+}
+
+// Updater updates one kind of software that the system package manager doesn't know about
+type Updater interface {
+	Name() string
+	// Update installs updates, returning a description of each thing it changed
+	Update(ctx context.Context, r shell.Runner) ([]string, error)
+}
+
+// Result is the outcome of running an Updater
+type Result struct {
+	Name     string
+	Changed  []string
+	Err      error
+	Duration time.Duration
+}
+
+// Enabled returns the updaters switched on in the config file
+func Enabled() ([]Updater, error) {
+	var config struct {
+		Updaters Config
+	}
+	if err := viper.Unmarshal(&config); err != nil {
+		return nil, err
+	}
+	c := config.Updaters
+
+	var u []Updater
+	if c.Flatpak {
+		u = append(u, Flatpak{})
+	}
+	if c.Snap {
+		u = append(u, Snap{})
+	}
+	if c.Rustup {
+		u = append(u, Rustup{})
+	}
+	if c.Pipx {
+		u = append(u, Pipx{})
+	}
+	if len(c.Go) > 0 {
+		u = append(u, Go{Packages: c.Go})
+	}
+	if c.Npm {
+		u = append(u, Npm{})
+	}
+	if c.Fwupd {
+		u = append(u, Fwupd{})
+	}
+
+	return u, nil
+}
+
+// Run runs each updater in turn. A failing updater is logged and reported in its result
+// rather than stopping the others. In a dry run Changed lists what would have changed.
+func Run(ctx context.Context, r shell.Runner, updaters []Updater) []Result {
+	var results []Result
+
+	for _, u := range updaters {
+		if ctx.Err() != nil {
+			break
+		}
+
+		start := time.Now()
+		changed, err := u.Update(ctx, r)
+		results = append(results, Result{
+			Name:     u.Name(),
+			Changed:  changed,
+			Err:      err,
+			Duration: time.Since(start),
+		})
+
+		switch {
+		case err != nil:
+			logrus.Errorf("%s: %s", u.Name(), err)
+		case len(changed) == 0:
+			fmt.Printf("%s: nothing to update\n", u.Name())
+		case plan.DryRun():
+			fmt.Printf("%s: would update %s\n", u.Name(), strings.Join(changed, ", "))
+		default:
+			fmt.Printf("%s: updated %s\n", u.Name(), strings.Join(changed, ", "))
+		}
+	}
+
+	return results
+}
+
+// capture runs a command that changes something, printing its output once it has finished.
+// Updates can take a while, so the "updater" timeout applies rather than the "capture" one.
+// In a dry run the command is only planned.
+func capture(ctx context.Context, r shell.Runner, cmd string, arg ...string) ([]byte, error) {
+	if plan.DryRun() {
+		plan.Command(cmd, arg...)
+		return nil, nil
+	}
+
+	fmt.Println(cmd, strings.Join(arg, " "))
+	out, err := r.Capture(shell.WithOperation(ctx, "updater"), cmd, arg...)
+	fmt.Print(string(out))
+	return out, err
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"context"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// defaultTimeouts are used for operations without a timeout in the config file
+var defaultTimeouts = map[string]time.Duration{
+	"http":     time.Minute,
+	"download": 30 * time.Minute,
+	"capture":  time.Minute,
+	"command":  2 * time.Hour,
+	"updater":  2 * time.Hour,
+	"watch":    0,
+}
+
+// Timeout returns how long an operation may take. It is read from timeouts.<operation>
+// in the config file, e.g. "timeouts: {download: 10m}". Zero means no limit.
+func Timeout(operation string) time.Duration {
+	key := "timeouts." + operation
+	if viper.IsSet(key) {
+		return viper.GetDuration(key)
+	}
+
+	return defaultTimeouts[operation]
+}
+
+// WithTimeout returns a context that expires after the timeout for operation
+func WithTimeout(ctx context.Context, operation string) (context.Context, context.CancelFunc) {
+	if t := Timeout(operation); t > 0 {
+		return context.WithTimeout(ctx, t)
+	}
+
+	return context.WithCancel(ctx)
+}
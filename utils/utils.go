@@ -2,9 +2,14 @@ package utils
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"regexp"
@@ -79,7 +84,11 @@ func GithubClient() (*github.Client, error) {
 	return client, nil
 }
 
-func DownloadFile(downloadURL, fileName string) error {
+// DownloadFile saves downloadURL as fileName. It gives up when ctx is cancelled or the
+// "download" timeout expires.
+func DownloadFile(ctx context.Context, downloadURL, fileName string) error {
+	ctx, cancel := WithTimeout(ctx, "download")
+	defer cancel()
 
 	tmp, err := os.Create(fileName)
 	if err != nil {
@@ -87,7 +96,12 @@ func DownloadFile(downloadURL, fileName string) error {
 	}
 	defer tmp.Close()
 
-	downloadResp, err := http.Get(downloadURL)
+	req, err := http.NewRequestWithContext(ctx, "GET", downloadURL, nil)
+	if err != nil {
+		return err
+	}
+
+	downloadResp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -108,11 +122,108 @@ func DownloadFile(downloadURL, fileName string) error {
 	return nil
 }
 
-func VersionFromURL(url string, selector string, regexstring string, name string, downloadURL string) (string, string, error) {
+// Get fetches a URL, returning the body
+func Get(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := WithTimeout(ctx, "http")
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("unable to fetch %s: %s", url, resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// PostJSON sends v, encoded as JSON, to a URL
+func PostJSON(ctx context.Context, url string, v interface{}) error {
+	ctx, cancel := WithTimeout(ctx, "http")
+	defer cancel()
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("unable to post to %s: %s", url, resp.Status)
+	}
+
+	return nil
+}
+
+// FileSHA256 returns the hex encoded SHA-256 digest of a file
+func FileSHA256(fileName string) (string, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// CopyFile copies src to dst, keeping the file mode
+func CopyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+func VersionFromURL(ctx context.Context, url string, selector string, regexstring string, name string, downloadURL string) (string, string, error) {
 	var remoteVersion string
 	client := &http.Client{}
 
-	req, err := http.NewRequest("GET", url, nil)
+	ctx, cancel := WithTimeout(ctx, "http")
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return "", "", err
 	}
@@ -205,31 +316,6 @@ func VersionFromURL(url string, selector string, regexstring string, name string
 	return remoteVersion, downloadURL, nil
 }
 
-func VersionMatch(remote, local string) bool {
-	remote = strings.TrimLeft(remote, "vV")
-	local = strings.TrimLeft(local, "vV")
-
-	dashIndex := strings.Index(local, "-")
-	if dashIndex >= 0 {
-		local = local[:dashIndex]
-	}
-
-	r := strings.Split(remote, ".")
-	l := strings.Split(local, ".")
-
-	for i, v := range r {
-		if i >= len(l) {
-			break
-		}
-
-		if v != l[i] {
-			return false
-		}
-	}
-
-	return true
-}
-
 func InList(s string, list []string) bool {
 	for _, a := range list {
 		if a == s {
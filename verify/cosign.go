@@ -0,0 +1,49 @@
+package verify
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// Cosign checks a cosign style blob signature: a base64 encoded ECDSA (or Ed25519)
+// signature over the SHA-256 of the file, checked against a PEM encoded public key
+func Cosign(data, signature, key []byte) error {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return errors.New("cosign public key: no PEM data found")
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("cosign public key: %s", err)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(signature)))
+	if err != nil {
+		// Some projects publish the raw signature rather than base64
+		sig = signature
+	}
+
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		if !ecdsa.VerifyASN1(k, digest[:], sig) {
+			return errors.New("cosign signature: verification failed")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, data, sig) {
+			return errors.New("cosign signature: verification failed")
+		}
+	default:
+		return fmt.Errorf("cosign public key: unsupported key type %T", pub)
+	}
+
+	return nil
+}
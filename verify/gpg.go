@@ -0,0 +1,31 @@
+package verify
+
+import (
+	"bytes"
+	"fmt"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// GPG checks an OpenPGP detached signature, armored or binary, against a public key or
+// keyring, which may also be armored or binary
+func GPG(data, signature, key []byte) error {
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(key))
+	if err != nil {
+		keyring, err = openpgp.ReadKeyRing(bytes.NewReader(key))
+		if err != nil {
+			return fmt.Errorf("reading OpenPGP key: %s", err)
+		}
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(signature), []byte("-----BEGIN")) {
+		_, err = openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(data), bytes.NewReader(signature))
+	} else {
+		_, err = openpgp.CheckDetachedSignature(keyring, bytes.NewReader(data), bytes.NewReader(signature))
+	}
+	if err != nil {
+		return fmt.Errorf("OpenPGP signature: %s", err)
+	}
+
+	return nil
+}
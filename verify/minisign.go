@@ -0,0 +1,92 @@
+package verify
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Minisign checks a minisign signature. Both legacy ("Ed") and pre-hashed ("ED")
+// signatures are supported, and the trusted comment is verified along with the file.
+func Minisign(data, signature, key []byte) error {
+	pub, err := decodeMinisignLine(key)
+	if err != nil {
+		return fmt.Errorf("minisign public key: %s", err)
+	}
+	if len(pub) != 2+8+ed25519.PublicKeySize || string(pub[:2]) != "Ed" {
+		return errors.New("minisign public key: unsupported key")
+	}
+
+	sig, err := decodeMinisignLine(signature)
+	if err != nil {
+		return fmt.Errorf("minisign signature: %s", err)
+	}
+	if len(sig) != 2+8+ed25519.SignatureSize {
+		return errors.New("minisign signature: wrong length")
+	}
+
+	if !bytes.Equal(sig[2:10], pub[2:10]) {
+		return fmt.Errorf("minisign signature: made with key %X, expected %X", sig[2:10], pub[2:10])
+	}
+
+	message := data
+	switch string(sig[:2]) {
+	case "Ed":
+	case "ED":
+		h := blake2b.Sum512(data)
+		message = h[:]
+	default:
+		return fmt.Errorf("minisign signature: unsupported algorithm %q", sig[:2])
+	}
+
+	key25519 := ed25519.PublicKey(pub[10:])
+	if !ed25519.Verify(key25519, message, sig[10:]) {
+		return errors.New("minisign signature: verification failed")
+	}
+
+	// The trusted comment is signed along with the file signature. minisign always writes
+	// it, so a signature without one has been stripped down.
+	lines := minisignLines(signature)
+	if len(lines) < 3 || !strings.HasPrefix(lines[1], "trusted comment: ") {
+		return errors.New("minisign signature: missing trusted comment")
+	}
+	comment := strings.TrimPrefix(lines[1], "trusted comment: ")
+	global, err := base64.StdEncoding.DecodeString(lines[2])
+	if err != nil {
+		return fmt.Errorf("minisign signature: %s", err)
+	}
+	signed := append(append([]byte{}, sig[10:]...), comment...)
+	if !ed25519.Verify(key25519, signed, global) {
+		return errors.New("minisign signature: trusted comment verification failed")
+	}
+
+	return nil
+}
+
+// minisignLines returns the lines of a minisign file, skipping the untrusted comment
+func minisignLines(b []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "untrusted comment:") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// decodeMinisignLine decodes the base64 data on the first line of a minisign file. A bare
+// base64 key, as given to minisign -P, is also accepted.
+func decodeMinisignLine(b []byte) ([]byte, error) {
+	lines := minisignLines(b)
+	if len(lines) == 0 {
+		return nil, errors.New("missing data")
+	}
+	return base64.StdEncoding.DecodeString(lines[0])
+}
@@ -0,0 +1,20 @@
+package verify
+
+import (
+	"fmt"
+)
+
+// Detached checks a detached signature over data using the given public key. kind picks the
+// signature format: "gpg", "minisign" or "cosign".
+func Detached(kind string, data, signature, key []byte) error {
+	switch kind {
+	case "gpg", "pgp":
+		return GPG(data, signature, key)
+	case "minisign":
+		return Minisign(data, signature, key)
+	case "cosign":
+		return Cosign(data, signature, key)
+	}
+
+	return fmt.Errorf("unknown signature type %q", kind)
+}
@@ -0,0 +1,189 @@
+package verify
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// signer generates a key pair for a signature scheme, returning the public key and a
+// function that signs with the private key
+type signer func(t *testing.T) (key []byte, sign func(data []byte) []byte)
+
+func gpgSigner(t *testing.T) ([]byte, func([]byte) []byte) {
+	entity, err := openpgp.NewEntity("jat test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var key bytes.Buffer
+	w, err := armor.Encode(&key, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	return key.Bytes(), func(data []byte) []byte {
+		var sig bytes.Buffer
+		if err := openpgp.ArmoredDetachSign(&sig, entity, bytes.NewReader(data), nil); err != nil {
+			t.Fatal(err)
+		}
+		return sig.Bytes()
+	}
+}
+
+// minisignSigner signs the way minisign -S does, pre-hashed if prehash is set
+func minisignSigner(prehash bool) signer {
+	return func(t *testing.T) ([]byte, func([]byte) []byte) {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := make([]byte, 8)
+		rand.Read(id)
+
+		key := fmt.Sprintf("untrusted comment: minisign public key\n%s\n",
+			base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), id...), pub...)))
+
+		return []byte(key), func(data []byte) []byte {
+			algorithm, message := "Ed", data
+			if prehash {
+				h := blake2b.Sum512(data)
+				algorithm, message = "ED", h[:]
+			}
+			sig := ed25519.Sign(priv, message)
+			comment := "timestamp:1639526400\tfile:jat"
+			global := ed25519.Sign(priv, append(append([]byte{}, sig...), comment...))
+
+			return []byte(fmt.Sprintf("untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+				base64.StdEncoding.EncodeToString(append(append([]byte(algorithm), id...), sig...)),
+				comment,
+				base64.StdEncoding.EncodeToString(global)))
+		}
+	}
+}
+
+func cosignECDSASigner(t *testing.T) ([]byte, func([]byte) []byte) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pemKey(t, &priv.PublicKey), func(data []byte) []byte {
+		digest := sha256.Sum256(data)
+		sig, err := ecdsa.SignASN1(rand.Reader, priv, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []byte(base64.StdEncoding.EncodeToString(sig))
+	}
+}
+
+func cosignEd25519Signer(t *testing.T) ([]byte, func([]byte) []byte) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pemKey(t, pub), func(data []byte) []byte {
+		return []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, data)))
+	}
+}
+
+func pemKey(t *testing.T, pub interface{}) []byte {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestDetached(t *testing.T) {
+	schemes := []struct {
+		kind   string
+		signer signer
+	}{
+		{"gpg", gpgSigner},
+		{"minisign", minisignSigner(true)},
+		{"minisign", minisignSigner(false)},
+		{"cosign", cosignECDSASigner},
+		{"cosign", cosignEd25519Signer},
+	}
+
+	artifact := []byte("#!/bin/sh\necho jat\n")
+
+	for i, scheme := range schemes {
+		key, sign := scheme.signer(t)
+		otherKey, _ := scheme.signer(t)
+		signature := sign(artifact)
+
+		tests := []struct {
+			name      string
+			data      []byte
+			signature []byte
+			key       []byte
+			wantErr   bool
+		}{
+			{name: "good", data: artifact, signature: signature, key: key},
+			{name: "tampered artifact", data: append([]byte("x"), artifact...), signature: signature, key: key, wantErr: true},
+			{name: "wrong key", data: artifact, signature: signature, key: otherKey, wantErr: true},
+			{name: "missing signature", data: artifact, signature: nil, key: key, wantErr: true},
+		}
+
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s/%d/%s", scheme.kind, i, tt.name), func(t *testing.T) {
+				err := Detached(scheme.kind, tt.data, tt.signature, tt.key)
+				if tt.wantErr && err == nil {
+					t.Error("verified, want an error")
+				}
+				if !tt.wantErr && err != nil {
+					t.Error(err)
+				}
+			})
+		}
+	}
+}
+
+func TestDetachedUnknownType(t *testing.T) {
+	if err := Detached("pgpx", nil, nil, nil); err == nil {
+		t.Error("unknown signature type accepted")
+	}
+}
+
+func TestMinisignTrustedComment(t *testing.T) {
+	key, sign := minisignSigner(true)(t)
+	artifact := []byte("#!/bin/sh\necho jat\n")
+	lines := strings.Split(string(sign(artifact)), "\n")
+
+	tests := []struct {
+		name      string
+		signature []string
+	}{
+		{"no trusted comment", lines[:2]},
+		{"no global signature", lines[:3]},
+		{"tampered comment", []string{lines[0], lines[1], lines[2] + "\tfile:other", lines[3]}},
+		{"comment without its prefix", []string{lines[0], lines[1], strings.TrimPrefix(lines[2], "trusted comment: "), lines[3]}},
+	}
+
+	for _, tt := range tests {
+		if err := Minisign(artifact, []byte(strings.Join(tt.signature, "\n")), key); err == nil {
+			t.Errorf("%s: verified, want an error", tt.name)
+		}
+	}
+}
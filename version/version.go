@@ -0,0 +1,313 @@
+package version
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a parsed version string. Debian style epochs and revisions are
+// supported alongside semver style pre-release tags, so "1:2.3-4ubuntu1",
+// "v1.10.0" and "2.0.0-rc.1" all parse. Build metadata after a "+" is ignored.
+type Version struct {
+	Epoch      int
+	Upstream   string
+	Prerelease string
+	Revision   string
+
+	hasEpoch bool
+}
+
+// Parse splits a version string into its components
+func Parse(s string) (Version, error) {
+	var v Version
+
+	s = strings.TrimSpace(s)
+	s = strings.TrimLeft(s, "vV")
+	if s == "" {
+		return v, fmt.Errorf("empty version")
+	}
+
+	if i := strings.Index(s, ":"); i >= 0 {
+		epoch, err := strconv.Atoi(s[:i])
+		if err != nil {
+			return v, fmt.Errorf("invalid epoch in version %q: %s", s, err)
+		}
+		v.Epoch = epoch
+		v.hasEpoch = true
+		s = strings.TrimLeft(s[i+1:], "vV")
+	}
+
+	// Build metadata ("1.2.3+build.5", "1.2+dfsg-1") doesn't order versions, so it
+	// is dropped wherever it appears
+	if i := strings.Index(s, "+"); i >= 0 {
+		if j := strings.Index(s[i:], "-"); j >= 0 {
+			s = s[:i] + s[i+j:]
+		} else {
+			s = s[:i]
+		}
+	}
+
+	// A dash followed by a letter is a semver pre-release ("1.2.0-rc1"), a
+	// dash followed by a digit is a Debian revision ("1.2.0-0ubuntu1").
+	if i := strings.Index(s, "-"); i >= 0 && i+1 < len(s) && isLetter(s[i+1]) {
+		v.Upstream = s[:i]
+		v.Prerelease = s[i+1:]
+	} else if i := strings.LastIndex(s, "-"); i >= 0 {
+		v.Upstream = s[:i]
+		v.Revision = s[i+1:]
+	} else {
+		v.Upstream = s
+	}
+
+	if v.Upstream == "" || !isDigit(v.Upstream[0]) {
+		return v, fmt.Errorf("version %q does not start with a digit", s)
+	}
+
+	return v, nil
+}
+
+// String reassembles the version
+func (v Version) String() string {
+	var b strings.Builder
+	if v.hasEpoch || v.Epoch != 0 {
+		b.WriteString(strconv.Itoa(v.Epoch))
+		b.WriteString(":")
+	}
+	b.WriteString(v.Upstream)
+	if v.Prerelease != "" {
+		b.WriteString("-")
+		b.WriteString(v.Prerelease)
+	}
+	if v.Revision != "" {
+		b.WriteString("-")
+		b.WriteString(v.Revision)
+	}
+	return b.String()
+}
+
+// Compare returns -1, 0 or 1 depending on whether a is older than, the same as,
+// or newer than b.
+func Compare(a, b Version) int {
+	if a.Epoch != b.Epoch {
+		if a.Epoch < b.Epoch {
+			return -1
+		}
+		return 1
+	}
+
+	au, bu := a.Upstream, b.Upstream
+	if dotted(au) && dotted(bu) {
+		au, bu = trimZeros(au), trimZeros(bu)
+	}
+	if c := debianCompare(au, bu); c != 0 {
+		return c
+	}
+
+	if c := comparePrerelease(a.Prerelease, b.Prerelease); c != 0 {
+		return c
+	}
+
+	return debianCompare(a.Revision, b.Revision)
+}
+
+// CompareStrings parses and compares two version strings
+func CompareStrings(a, b string) (int, error) {
+	va, err := Parse(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := Parse(b)
+	if err != nil {
+		return 0, err
+	}
+
+	return Compare(va, vb), nil
+}
+
+// Newer reports whether remote is strictly newer than local. Version strings
+// scraped from download pages rarely carry a Debian epoch or revision, so if
+// remote doesn't specify one the local value is ignored rather than counted.
+// A local version that can't be parsed is an error, rather than a reason to
+// replace it with whatever the remote version is.
+func Newer(remote, local string) (bool, error) {
+	r, err := Parse(remote)
+	if err != nil {
+		return false, err
+	}
+	l, err := Parse(local)
+	if err != nil {
+		return false, fmt.Errorf("installed version: %s", err)
+	}
+
+	if !r.hasEpoch {
+		l.Epoch = 0
+	}
+	if r.Revision == "" {
+		l.Revision = ""
+	}
+
+	return Compare(r, l) > 0, nil
+}
+
+// dotted returns true for plain dotted versions like "1.10.0"
+func dotted(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) && s[i] != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// trimZeros drops trailing ".0" parts from a plain dotted version, so that "1.10"
+// and "1.10.0" compare as the same version
+func trimZeros(s string) string {
+	parts := strings.Split(s, ".")
+	for len(parts) > 1 && strings.Trim(parts[len(parts)-1], "0") == "" {
+		parts = parts[:len(parts)-1]
+	}
+	return strings.Join(parts, ".")
+}
+
+// debianCompare implements the dpkg verrevcmp algorithm: alternating runs of
+// non-digits, compared character by character with "~" sorting before
+// everything (even the end of the string) and letters before other symbols,
+// and runs of digits, compared numerically.
+func debianCompare(a, b string) int {
+	for a != "" || b != "" {
+		for (a != "" && !isDigit(a[0])) || (b != "" && !isDigit(b[0])) {
+			ac, bc := 0, 0
+			if a != "" {
+				ac = order(a[0])
+			}
+			if b != "" {
+				bc = order(b[0])
+			}
+			if ac != bc {
+				if ac < bc {
+					return -1
+				}
+				return 1
+			}
+			if a != "" {
+				a = a[1:]
+			}
+			if b != "" {
+				b = b[1:]
+			}
+		}
+
+		var an, bn string
+		an, a = leadingDigits(a)
+		bn, b = leadingDigits(b)
+		if c := compareNumeric(an, bn); c != 0 {
+			return c
+		}
+	}
+
+	return 0
+}
+
+// order gives the sort weight of a non-digit character in a Debian version
+func order(c byte) int {
+	switch {
+	case isDigit(c):
+		return 0
+	case isLetter(c):
+		return int(c)
+	case c == '~':
+		return -1
+	default:
+		return int(c) + 256
+	}
+}
+
+// comparePrerelease follows semver precedence: a version without a pre-release
+// tag is newer than one with, and dot separated identifiers are compared
+// numerically when both are numbers, lexically otherwise.
+func comparePrerelease(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return 1
+	}
+	if b == "" {
+		return -1
+	}
+
+	ap := strings.Split(a, ".")
+	bp := strings.Split(b, ".")
+
+	for i := 0; i < len(ap) && i < len(bp); i++ {
+		an, aNum := numeric(ap[i])
+		bn, bNum := numeric(bp[i])
+
+		switch {
+		case aNum && bNum:
+			if c := compareNumeric(an, bn); c != 0 {
+				return c
+			}
+		case aNum:
+			return -1
+		case bNum:
+			return 1
+		default:
+			// Tags like "rc10" are common, so compare them the Debian way to
+			// put rc10 after rc9.
+			if c := debianCompare(ap[i], bp[i]); c != 0 {
+				return c
+			}
+		}
+	}
+
+	switch {
+	case len(ap) < len(bp):
+		return -1
+	case len(ap) > len(bp):
+		return 1
+	}
+	return 0
+}
+
+func numeric(s string) (string, bool) {
+	if s == "" {
+		return s, false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return s, false
+		}
+	}
+	return s, true
+}
+
+// compareNumeric compares two strings of digits of any length
+func compareNumeric(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func leadingDigits(s string) (string, string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,128 @@
+package version
+
+import "testing"
+
+func TestCompareStrings(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.2.3", "1.2.4", -1},
+		{"1.10.0", "1.9.9", 1},
+		{"v1.2.3", "1.2.3", 0},
+		{"1.10", "1.10.0", 0},
+		{"1.10.0.0", "1.10", 0},
+		{"1", "1.0", 0},
+		{"1.10", "1.10.1", -1},
+		{"1.0", "1.0a", -1},
+		{"1:1.0", "2.0", 1},
+		{"0:1.0", "1.0", 0},
+		{"2:1.0", "1:9.0", 1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0~~", "1.0~", -1},
+		{"1.0-1", "1.0-2", -1},
+		{"1.0-0ubuntu1", "1.0-0ubuntu2", -1},
+		{"1.0-10", "1.0-9", 1},
+		{"2.0.0-rc.1", "2.0.0", -1},
+		{"2.0.0-alpha", "2.0.0-beta", -1},
+		{"2.0.0-rc.1", "2.0.0-rc.2", -1},
+		{"2.0.0-rc.2", "2.0.0-rc.10", -1},
+		{"2.0.0-rc9", "2.0.0-rc10", -1},
+		{"2.0.0-alpha.1", "2.0.0-alpha", 1},
+		{"2.0.0-alpha.1", "2.0.0-alpha.beta", -1},
+		{"2.0.0-rc.1+build5", "2.0.0-rc.1", 0},
+		{"1.2.3+build5", "1.2.3", 0},
+		{"1.2.3+build5", "1.2.4", -1},
+		{"1:1.2+dfsg-1", "1:1.2-1", 0},
+	}
+
+	for _, tt := range tests {
+		got, err := CompareStrings(tt.a, tt.b)
+		if err != nil {
+			t.Errorf("CompareStrings(%q, %q): %s", tt.a, tt.b, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("CompareStrings(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Version
+		wantErr bool
+	}{
+		{in: "1.2.3", want: Version{Upstream: "1.2.3"}},
+		{in: "v1.2.3", want: Version{Upstream: "1.2.3"}},
+		{in: "1:2.3-4ubuntu1", want: Version{Epoch: 1, Upstream: "2.3", Revision: "4ubuntu1", hasEpoch: true}},
+		{in: "2.0.0-rc.1", want: Version{Upstream: "2.0.0", Prerelease: "rc.1"}},
+		{in: "1.2-3-4", want: Version{Upstream: "1.2-3", Revision: "4"}},
+		{in: "", wantErr: true},
+		{in: "latest", wantErr: true},
+		{in: "x:1.0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Parse(%q) = %+v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q): %s", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNewer(t *testing.T) {
+	tests := []struct {
+		remote, local string
+		want          bool
+		wantErr       bool
+	}{
+		{remote: "1.10.0", local: "1.10", want: false},
+		{remote: "1.10.1", local: "1.10", want: true},
+		{remote: "1.9", local: "1.10", want: false},
+		{remote: "1.2.3", local: "1:1.2.3-0ubuntu1", want: false},
+		{remote: "1.2.4", local: "1:1.2.3-0ubuntu1", want: true},
+		{remote: "1.2.3-2", local: "1.2.3-1", want: true},
+		{remote: "2.0.0", local: "2.0.0-rc.1", want: true},
+		{remote: "2.0.0-rc.1", local: "1.9.0", want: true},
+		{remote: "1.2.3+build.7", local: "1.2.3", want: false},
+		{remote: "1.2.3", local: "1.2.3+build.7", want: false},
+		{remote: "1.2.4+build.1", local: "1.2.3+build.9", want: true},
+		{remote: "2.0.0-rc.2+build.1", local: "2.0.0-rc.1", want: true},
+		{remote: "2.0.0-rc.1+build.1", local: "2.0.0-rc.1+build.2", want: false},
+		{remote: "1.2+dfsg-2", local: "1.2-1", want: true},
+		{remote: "1.0", local: "unknown", wantErr: true},
+		{remote: "0.9", local: "", wantErr: true},
+		{remote: "unknown", local: "1.0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := Newer(tt.remote, tt.local)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Newer(%q, %q) = %v, want an error", tt.remote, tt.local, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Newer(%q, %q): %s", tt.remote, tt.local, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Newer(%q, %q) = %v, want %v", tt.remote, tt.local, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"log/syslog"
+	"strings"
+	"time"
+
+	"github.com/dooferlad/jat/shell"
+	"github.com/dooferlad/jat/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// Alert states
+const (
+	Firing   = "firing"
+	Resolved = "resolved"
+)
+
+// Event is sent to alert actions when a watch starts or stops matching
+type Event struct {
+	State   string    `json:"state"`
+	Command string    `json:"command"`
+	Output  string    `json:"output"`
+	Time    time.Time `json:"time"`
+}
+
+// Action is something done when an alert fires or resolves
+type Action interface {
+	Name() string
+	Send(ctx context.Context, e Event) error
+}
+
+// Command runs a shell command, with the state and output of the event as $1 and $2
+type Command struct {
+	Runner  shell.Runner
+	Command string
+}
+
+func (c Command) Name() string { return "command" }
+
+func (c Command) Send(ctx context.Context, e Event) error {
+	return c.Runner.Run(ctx, "sh", "-c", c.Command, "jat", e.State, e.Output)
+}
+
+// Webhook posts the event as JSON to a URL
+type Webhook struct {
+	URL string
+}
+
+func (w Webhook) Name() string { return "webhook" }
+
+func (w Webhook) Send(ctx context.Context, e Event) error {
+	return utils.PostJSON(ctx, w.URL, e)
+}
+
+// Notify shows a desktop notification by calling the freedesktop.org notification service
+// over D-Bus with gdbus
+type Notify struct {
+	Runner shell.Runner
+}
+
+func (n Notify) Name() string { return "notify" }
+
+func (n Notify) Send(ctx context.Context, e Event) error {
+	// Urgency 2 is critical, 1 normal
+	urgency := 2
+	if e.State == Resolved {
+		urgency = 1
+	}
+	// Notify(app_name, replaces_id, app_icon, summary, body, actions, hints, expire_timeout),
+	// where an expire_timeout of -1 leaves it to the notification server. Numbers are typed
+	// so they don't depend on introspection, which also keeps -1 from looking like a flag.
+	_, err := n.Runner.Capture(ctx, "gdbus", "call", "--session",
+		"--dest", "org.freedesktop.Notifications",
+		"--object-path", "/org/freedesktop/Notifications",
+		"--method", "org.freedesktop.Notifications.Notify",
+		gvariantString("jat"), "uint32 0", gvariantString(""),
+		gvariantString(e.Command+" "+e.State), gvariantString(e.Output),
+		"@as []", fmt.Sprintf("{'urgency': <byte %d>}", urgency), "int32 -1")
+	return err
+}
+
+// gvariantString quotes s in the GVariant text format gdbus parses its arguments with, so
+// output that looks like a number or a list is still sent as a string
+func gvariantString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\t':
+			sb.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&sb, `\u%04x`, r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// Syslog writes the event to syslog, which journald also collects
+type Syslog struct{}
+
+func (Syslog) Name() string { return "syslog" }
+
+func (Syslog) Send(ctx context.Context, e Event) error {
+	w, err := syslog.New(syslog.LOG_DAEMON|syslog.LOG_WARNING, "jat")
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	msg := fmt.Sprintf("%s %s: %s", e.Command, e.State, e.Output)
+	if e.State == Resolved {
+		return w.Notice(msg)
+	}
+	return w.Warning(msg)
+}
+
+// alertQueue is how many events can be waiting to be sent before new ones are dropped
+const alertQueue = 64
+
+// now is the clock alerts are timed by, a variable so tests can move it on
+var now = time.Now
+
+// Alerter sends events to its actions as a watch starts and stops matching. Each action is
+// sent at most one firing event every Every, whether it is a reminder while the watch keeps
+// matching or the watch starting to match again, and a resolved event that comes within
+// Every of the firing one is held back until the window is over, so a flapping watch
+// doesn't send a pair of events every time it is run. Events are sent in the background,
+// in order, so a slow action doesn't hold up the watch; Close waits for them to go.
+type Alerter struct {
+	Command string
+	Actions []Action
+	Every   time.Duration
+
+	// notified is whether each action was last sent a firing event
+	notified []bool
+	// fired is when each action was sent the firing event that started its alert, and
+	// last when it was last sent one, reminders included
+	fired []time.Time
+	last  []time.Time
+	// held is the resolved event waiting for the window to close, if there is one
+	held *Event
+
+	queue chan func()
+	done  chan struct{}
+}
+
+// Update tells the alerter whether the watch is matching, sending a firing event if it
+// has started matching or a reminder is due, and a resolved event if it has stopped
+func (a *Alerter) Update(ctx context.Context, matching bool, output string) {
+	if a.notified == nil {
+		a.notified = make([]bool, len(a.Actions))
+		a.fired = make([]time.Time, len(a.Actions))
+		a.last = make([]time.Time, len(a.Actions))
+	}
+	a.held = nil
+
+	e := Event{
+		State:   Firing,
+		Command: a.Command,
+		Output:  output,
+		Time:    now(),
+	}
+	if !matching {
+		e.State = Resolved
+	}
+
+	for i, action := range a.Actions {
+		switch {
+		case matching && e.Time.Sub(a.last[i]) < a.Every:
+			continue
+		case matching:
+			if !a.notified[i] {
+				a.fired[i] = e.Time
+			}
+			a.last[i] = e.Time
+			a.notified[i] = true
+		case !a.notified[i]:
+			continue
+		case e.Time.Sub(a.fired[i]) < a.Every:
+			a.held = &e
+			continue
+		default:
+			a.notified[i] = false
+		}
+		a.send(ctx, action, e)
+	}
+}
+
+// send queues e to be sent to action, starting the sender if it isn't running yet
+func (a *Alerter) send(ctx context.Context, action Action, e Event) {
+	if a.queue == nil {
+		a.queue = make(chan func(), alertQueue)
+		a.done = make(chan struct{})
+		go func() {
+			defer close(a.done)
+			for send := range a.queue {
+				send()
+			}
+		}()
+	}
+
+	select {
+	case a.queue <- func() {
+		if err := action.Send(ctx, e); err != nil {
+			logrus.WithError(err).Warnf("sending %s alert", action.Name())
+		}
+	}:
+	default:
+		logrus.Warnf("dropping %s %s alert, too many are waiting to be sent", action.Name(), e.State)
+	}
+}
+
+// Close waits for queued events to be sent. The alerter can't be updated afterwards.
+func (a *Alerter) Close() {
+	// A resolution still being held back goes out now, so nothing is left looking like it
+	// is firing
+	if a.held != nil {
+		for i, action := range a.Actions {
+			if a.notified[i] {
+				a.send(context.Background(), action, *a.held)
+				a.notified[i] = false
+			}
+		}
+		a.held = nil
+	}
+
+	if a.queue == nil {
+		return
+	}
+	close(a.queue)
+	<-a.done
+}
@@ -0,0 +1,227 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dooferlad/jat/shell"
+)
+
+// recorder is an Action that keeps the events it is sent
+type recorder struct {
+	events *[]Event
+}
+
+func (r recorder) Name() string { return "recorder" }
+
+func (r recorder) Send(ctx context.Context, e Event) error {
+	*r.events = append(*r.events, e)
+	return nil
+}
+
+func TestWebhook(t *testing.T) {
+	var got Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s with content type %q, want a JSON POST", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+
+	want := Event{
+		State:   Firing,
+		Command: "zpool status -x",
+		Output:  "pool rpool is DEGRADED",
+		Time:    time.Date(2021, 12, 18, 10, 0, 0, 0, time.UTC),
+	}
+	if err := (Webhook{URL: server.URL}).Send(context.Background(), want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestWebhookFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	if err := (Webhook{URL: server.URL}).Send(context.Background(), Event{State: Firing}); err == nil {
+		t.Error("a 500 response wasn't reported")
+	}
+}
+
+func TestAlerter(t *testing.T) {
+	start := time.Date(2021, 12, 18, 10, 0, 0, 0, time.UTC)
+	clock := start
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	var events []Event
+	a := Alerter{Command: "probe", Actions: []Action{recorder{&events}}, Every: 5 * time.Minute}
+
+	ctx := context.Background()
+	for _, step := range []struct {
+		after    time.Duration
+		matching bool
+		output   string
+	}{
+		{0, false, "ok"},
+		{time.Minute, true, "bad"},              // fires
+		{2 * time.Minute, true, "still bad"},    // too soon for a reminder
+		{7 * time.Minute, true, "bad for ages"}, // reminder
+		{8 * time.Minute, false, "ok again"},    // resolves
+		{9 * time.Minute, false, "still ok"},
+		{10 * time.Minute, true, "bad again"},     // too soon after the reminder
+		{12 * time.Minute, true, "bad once more"}, // fires again
+	} {
+		clock = start.Add(step.after)
+		a.Update(ctx, step.matching, step.output)
+	}
+	a.Close()
+
+	var got []string
+	for _, e := range events {
+		got = append(got, e.Time.Sub(start).String()+" "+e.State+" "+e.Output)
+	}
+	want := []string{
+		"1m0s firing bad",
+		"7m0s firing bad for ages",
+		"8m0s resolved ok again",
+		"12m0s firing bad once more",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAlerterFlapping(t *testing.T) {
+	start := time.Date(2021, 12, 18, 10, 0, 0, 0, time.UTC)
+	clock := start
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	var events []Event
+	a := Alerter{Command: "probe", Actions: []Action{recorder{&events}}, Every: 5 * time.Minute}
+
+	ctx := context.Background()
+	for _, step := range []struct {
+		after    time.Duration
+		matching bool
+		output   string
+	}{
+		{0, true, "bad"}, // fires
+		{time.Minute, false, "ok"},
+		{2 * time.Minute, true, "bad"},
+		{3 * time.Minute, false, "ok"},
+		{4 * time.Minute, true, "bad"},
+		{6 * time.Minute, false, "ok"},         // resolves once the window is over
+		{7 * time.Minute, true, "bad"},         // fires again
+		{8 * time.Minute, false, "ok at last"}, // held back until Close
+	} {
+		clock = start.Add(step.after)
+		a.Update(ctx, step.matching, step.output)
+	}
+	a.Close()
+
+	var got []string
+	for _, e := range events {
+		got = append(got, e.Time.Sub(start).String()+" "+e.State+" "+e.Output)
+	}
+	want := []string{
+		"0s firing bad",
+		"6m0s resolved ok",
+		"7m0s firing bad",
+		"8m0s resolved ok at last",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// blocked is an Action that doesn't return until release is closed
+type blocked struct {
+	release chan struct{}
+	sent    *int
+}
+
+func (b blocked) Name() string { return "blocked" }
+
+func (b blocked) Send(ctx context.Context, e Event) error {
+	<-b.release
+	*b.sent++
+	return nil
+}
+
+func TestAlerterDoesNotWait(t *testing.T) {
+	sent := 0
+	action := blocked{release: make(chan struct{}), sent: &sent}
+	a := Alerter{Command: "probe", Actions: []Action{action}}
+
+	updated := make(chan struct{})
+	go func() {
+		a.Update(context.Background(), true, "bad")
+		a.Update(context.Background(), false, "ok")
+		close(updated)
+	}()
+
+	select {
+	case <-updated:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Update waited for a slow action")
+	}
+
+	close(action.release)
+	a.Close()
+	if sent != 2 {
+		t.Errorf("sent %d events, want 2", sent)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	f := shell.NewFake()
+	e := Event{State: Resolved, Command: "probe", Output: "said \"ok\"\n"}
+	if err := (Notify{Runner: f}).Send(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := f.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("got calls %+v, want one", calls)
+	}
+	want := []string{"gdbus", "call", "--session",
+		"--dest", "org.freedesktop.Notifications",
+		"--object-path", "/org/freedesktop/Notifications",
+		"--method", "org.freedesktop.Notifications.Notify",
+		`"jat"`, "uint32 0", `""`, `"probe resolved"`, `"said \"ok\"\n"`,
+		"@as []", "{'urgency': <byte 1>}", "int32 -1"}
+	if !reflect.DeepEqual(calls[0].Command, want) {
+		t.Errorf("ran %q, want %q", calls[0].Command, want)
+	}
+}
+
+func TestGVariantString(t *testing.T) {
+	for s, want := range map[string]string{
+		"":            `""`,
+		"42":          `"42"`,
+		"[1, 2]":      `"[1, 2]"`,
+		`a "b" \ c`:   `"a \"b\" \\ c"`,
+		"tab\there\n": `"tab\there\n"`,
+		"bell\a":      `"bell\u0007"`,
+		"température": `"température"`,
+	} {
+		if got := gvariantString(s); got != want {
+			t.Errorf("gvariantString(%q) = %s, want %s", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package watch
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff is a delay that doubles each time it is used, up to Max
+type Backoff struct {
+	Min time.Duration
+	Max time.Duration
+	// Jitter spreads each delay randomly by up to this fraction either way, so that many
+	// watchers failing together don't all retry together
+	Jitter float64
+
+	next time.Duration
+}
+
+// Next returns how long to wait before the next attempt
+func (b *Backoff) Next() time.Duration {
+	if b.next < b.Min {
+		b.next = b.Min
+	}
+
+	d := b.next
+	b.next *= 2
+	if b.next > b.Max {
+		b.next = b.Max
+	}
+
+	if b.Jitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * b.Jitter * float64(d))
+	}
+	return d
+}
+
+// Reset goes back to the minimum delay, after an attempt that went well
+func (b *Backoff) Reset() {
+	b.next = b.Min
+}
@@ -0,0 +1,31 @@
+package watch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := Backoff{Min: time.Second, Max: 10 * time.Second}
+
+	for i, want := range []time.Duration{1, 2, 4, 8, 10, 10} {
+		if got := b.Next(); got != want*time.Second {
+			t.Errorf("delay %d: got %s, want %s", i, got, want*time.Second)
+		}
+	}
+
+	b.Reset()
+	if got := b.Next(); got != time.Second {
+		t.Errorf("got %s after Reset, want %s", got, time.Second)
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	b := Backoff{Min: time.Second, Max: time.Second, Jitter: 0.2}
+
+	for i := 0; i < 100; i++ {
+		if got := b.Next(); got < 800*time.Millisecond || got > 1200*time.Millisecond {
+			t.Fatalf("got %s, want within 20%% of 1s", got)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package watch
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// diffContext is how many unchanged lines are shown around each change
+const diffContext = 3
+
+// edit is a line of a diff: ' ' for unchanged, '-' for removed or '+' for added
+type edit struct {
+	kind byte
+	line string
+}
+
+// Lines splits output into lines, ignoring a trailing newline
+func Lines(output []byte) []string {
+	s := strings.TrimSuffix(string(output), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// Diff returns a unified diff between two versions of a command's output, labelled with
+// the times they were captured, or "" if they are the same
+func Diff(a, b []string, aTime, bTime time.Time) string {
+	edits := diffLines(a, b)
+
+	var changes []int
+	for i, e := range edits {
+		if e.kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	// aLine[i] and bLine[i] are how many lines of a and b come before edits[i]
+	aLine := make([]int, len(edits)+1)
+	bLine := make([]int, len(edits)+1)
+	for i, e := range edits {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if e.kind != '+' {
+			aLine[i+1]++
+		}
+		if e.kind != '-' {
+			bLine[i+1]++
+		}
+	}
+
+	var sb strings.Builder
+	const stamp = "2006-01-02 15:04:05.000000000 -0700"
+	fmt.Fprintf(&sb, "--- previous\t%s\n", aTime.Format(stamp))
+	fmt.Fprintf(&sb, "+++ current\t%s\n", bTime.Format(stamp))
+
+	for len(changes) > 0 {
+		// Changes close enough together for their context to touch share a hunk, as they do
+		// with up to 2*diffContext unchanged lines between them
+		last := 0
+		for last+1 < len(changes) && changes[last+1]-changes[last] <= 2*diffContext+1 {
+			last++
+		}
+
+		start := changes[0] - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := changes[last] + diffContext + 1
+		if end > len(edits) {
+			end = len(edits)
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n",
+			hunkRange(aLine[start], aLine[end]-aLine[start]),
+			hunkRange(bLine[start], bLine[end]-bLine[start]))
+		for _, e := range edits[start:end] {
+			sb.WriteByte(e.kind)
+			sb.WriteString(e.line)
+			sb.WriteByte('\n')
+		}
+
+		changes = changes[last+1:]
+	}
+
+	return sb.String()
+}
+
+// hunkRange formats the start and length of one side of a hunk the way diff -u does
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+// diffLines finds the edits that turn a into b using the longest common subsequence of
+// their lines. Output usually changes in only a few places, so the common prefix and
+// suffix are trimmed first to keep the table small.
+func diffLines(a, b []string) []edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var edits []edit
+	for _, line := range a[:prefix] {
+		edits = append(edits, edit{' ', line})
+	}
+
+	am, bm := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	// lcs[i][j] is the length of the longest common subsequence of am[i:] and bm[j:]
+	lcs := make([][]int, len(am)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bm)+1)
+	}
+	for i := len(am) - 1; i >= 0; i-- {
+		for j := len(bm) - 1; j >= 0; j-- {
+			if am[i] == bm[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(am) || j < len(bm) {
+		switch {
+		case i < len(am) && j < len(bm) && am[i] == bm[j]:
+			edits = append(edits, edit{' ', am[i]})
+			i++
+			j++
+		case j == len(bm) || (i < len(am) && lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{'-', am[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', bm[j]})
+			j++
+		}
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		edits = append(edits, edit{' ', line})
+	}
+
+	return edits
+}
@@ -0,0 +1,101 @@
+package watch
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLines(t *testing.T) {
+	for output, want := range map[string][]string{
+		"":       nil,
+		"\n":     nil,
+		"a\nb\n": {"a", "b"},
+		"a\nb":   {"a", "b"},
+		"a\n\nb": {"a", "", "b"},
+	} {
+		if got := Lines([]byte(output)); !reflect.DeepEqual(got, want) {
+			t.Errorf("Lines(%q) = %q, want %q", output, got, want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	aTime := time.Date(2021, 12, 18, 10, 0, 0, 0, time.UTC)
+	bTime := aTime.Add(time.Second)
+	header := "--- previous\t2021-12-18 10:00:00.000000000 +0000\n" +
+		"+++ current\t2021-12-18 10:00:01.000000000 +0000\n"
+
+	for _, test := range []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{
+			name: "same",
+			a:    "a\nb\n",
+			b:    "a\nb\n",
+		},
+		{
+			name: "removed",
+			a:    "1\n2\n3\n4\n5\n",
+			b:    "1\n2\n4\n5\n",
+			want: "@@ -1,5 +1,4 @@\n 1\n 2\n-3\n 4\n 5\n",
+		},
+		{
+			name: "from nothing",
+			a:    "",
+			b:    "x\ny\n",
+			want: "@@ -0,0 +1,2 @@\n+x\n+y\n",
+		},
+		{
+			name: "to nothing",
+			a:    "x\n",
+			b:    "",
+			want: "@@ -1 +0,0 @@\n-x\n",
+		},
+		{
+			name: "separate hunks",
+			a:    "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn\n",
+			b:    "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn\nnew\n",
+			want: "@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n" +
+				"@@ -12,3 +12,4 @@\n l\n m\n n\n+new\n",
+		},
+		{
+			name: "nearby changes share a hunk",
+			a:    "a\nb\nc\nd\ne\nf\ng\nh\n",
+			b:    "a\nB\nc\nd\ne\nf\nG\nh\n",
+			want: "@@ -1,8 +1,8 @@\n a\n-b\n+B\n c\n d\n e\n f\n-g\n+G\n h\n",
+		},
+		{
+			name: "six lines apart share a hunk",
+			a:    "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n",
+			b:    "a\nB\nc\nd\ne\nf\ng\nh\nI\nj\n",
+			want: "@@ -1,10 +1,10 @@\n a\n-b\n+B\n c\n d\n e\n f\n g\n h\n-i\n+I\n j\n",
+		},
+		{
+			name: "seven lines apart don't",
+			a:    "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\n",
+			b:    "a\nB\nc\nd\ne\nf\ng\nh\ni\nJ\nk\n",
+			want: "@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n" +
+				"@@ -7,5 +7,5 @@\n g\n h\n i\n-j\n+J\n k\n",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := Diff(Lines([]byte(test.a)), Lines([]byte(test.b)), aTime, bTime)
+			if test.want == "" {
+				if got != "" {
+					t.Errorf("got diff %q for the same output", got)
+				}
+				return
+			}
+			if !strings.HasPrefix(got, header) {
+				t.Fatalf("got %q, want it to start with %q", got, header)
+			}
+			if got = strings.TrimPrefix(got, header); got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
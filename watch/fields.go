@@ -0,0 +1,59 @@
+package watch
+
+import (
+	"regexp"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FieldNames returns the names of the named capture groups in re, in order
+func FieldNames(re *regexp.Regexp) []string {
+	var names []string
+	if re == nil {
+		return names
+	}
+	for _, name := range re.SubexpNames() {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Fields returns the named capture groups of the first match of re in output, or nil if
+// it doesn't match
+func Fields(re *regexp.Regexp, output []byte) map[string]string {
+	if re == nil {
+		return nil
+	}
+	m := re.FindSubmatch(output)
+	if m == nil {
+		return nil
+	}
+
+	fields := map[string]string{}
+	for i, name := range re.SubexpNames() {
+		if name != "" && m[i] != nil {
+			fields[name] = string(m[i])
+		}
+	}
+	return fields
+}
+
+// value returns a field as a number if it is one, so that it is logged and written as one
+func value(s string) interface{} {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return s
+}
+
+// LogFields turns extracted fields into structured log fields
+func LogFields(fields map[string]string) logrus.Fields {
+	lf := logrus.Fields{}
+	for name, v := range fields {
+		lf[name] = value(v)
+	}
+	return lf
+}
@@ -0,0 +1,128 @@
+package watch
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Series writes the fields extracted from each sample to a file, as CSV or JSON lines
+type Series struct {
+	f      *os.File
+	format string
+	names  []string
+	csv    *csv.Writer
+}
+
+// NewSeries appends samples of the named fields to fileName. format is "csv" or "json";
+// if it is empty it is taken from the file's extension, defaulting to JSON lines. A CSV
+// header is written when the file is new; appending to a CSV file with a different
+// header is refused, as the columns wouldn't line up.
+func NewSeries(fileName, format string, names []string) (*Series, error) {
+	if format == "" {
+		format = "json"
+		if filepath.Ext(fileName) == ".csv" {
+			format = "csv"
+		}
+	}
+	if format != "csv" && format != "json" {
+		return nil, fmt.Errorf("unknown series format %q, expected csv or json", format)
+	}
+
+	header := append([]string{"time"}, names...)
+	var existing []string
+	if format == "csv" {
+		var err error
+		if existing, err = csvHeader(fileName); err != nil {
+			return nil, fmt.Errorf("reading series file %s: %s", fileName, err)
+		}
+		if existing != nil && strings.Join(existing, ",") != strings.Join(header, ",") {
+			return nil, fmt.Errorf("series file %s has the columns %s, not %s", fileName, strings.Join(existing, ","), strings.Join(header, ","))
+		}
+	}
+
+	f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	s := Series{
+		f:      f,
+		format: format,
+		names:  names,
+	}
+
+	if format == "csv" {
+		s.csv = csv.NewWriter(f)
+		if existing == nil {
+			// Flushed now, so the file has its header even if no sample is ever written
+			s.csv.Write(header)
+			s.csv.Flush()
+			if err := s.csv.Error(); err != nil {
+				f.Close()
+				return nil, err
+			}
+		}
+	}
+
+	return &s, nil
+}
+
+// csvHeader returns the first record of a CSV file, or nil if the file doesn't exist or
+// is empty
+func csvHeader(fileName string) ([]string, error) {
+	f, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	return header, err
+}
+
+// Write records the fields of one sample
+func (s *Series) Write(t time.Time, fields map[string]string) error {
+	if s.format == "csv" {
+		record := []string{t.Format(time.RFC3339Nano)}
+		for _, name := range s.names {
+			record = append(record, fields[name])
+		}
+		if err := s.csv.Write(record); err != nil {
+			return err
+		}
+		s.csv.Flush()
+		return s.csv.Error()
+	}
+
+	sample := map[string]interface{}{
+		"time": t,
+	}
+	for name, v := range fields {
+		sample[name] = value(v)
+	}
+	b, err := json.Marshal(sample)
+	if err != nil {
+		return err
+	}
+	_, err = s.f.Write(append(b, '\n'))
+	return err
+}
+
+// Close closes the file
+func (s *Series) Close() error {
+	return s.f.Close()
+}
@@ -0,0 +1,112 @@
+package watch
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeSeries(t *testing.T, fileName, format string, names []string, samples ...map[string]string) {
+	s, err := NewSeries(fileName, format, names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2021, 12, 18, 10, 0, 0, 0, time.UTC)
+	for i, fields := range samples {
+		if err := s.Write(start.Add(time.Duration(i)*time.Second), fields); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, fileName string) string {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestSeriesCSV(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "temps.csv")
+	names := []string{"temp", "fan"}
+
+	writeSeries(t, fileName, "", names,
+		map[string]string{"temp": "45.5", "fan": "1200"},
+		map[string]string{"temp": "47"})
+	// Appending carries on under the same header
+	writeSeries(t, fileName, "", names, map[string]string{"temp": "50", "fan": "a, b"})
+
+	want := "time,temp,fan\n" +
+		"2021-12-18T10:00:00Z,45.5,1200\n" +
+		"2021-12-18T10:00:01Z,47,\n" +
+		"2021-12-18T10:00:00Z,50,\"a, b\"\n"
+	if got := readFile(t, fileName); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSeriesCSVHeaderWithoutSamples(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "temps.csv")
+	names := []string{"temp", "fan"}
+
+	writeSeries(t, fileName, "", names)
+	if got, want := readFile(t, fileName), "time,temp,fan\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// The header is found again, not written twice
+	writeSeries(t, fileName, "", names, map[string]string{"temp": "45"})
+	if got, want := readFile(t, fileName), "time,temp,fan\n2021-12-18T10:00:00Z,45,\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSeriesCSVRefusesOtherColumns(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "temps.csv")
+	writeSeries(t, fileName, "csv", []string{"temp", "fan"}, map[string]string{"temp": "45"})
+
+	for _, names := range [][]string{{"fan", "temp"}, {"temp"}, {"temp", "fan", "load"}} {
+		if s, err := NewSeries(fileName, "csv", names); err == nil {
+			s.Close()
+			t.Errorf("appended %q to a file with the columns time,temp,fan", names)
+		}
+	}
+
+	if got := readFile(t, fileName); strings.Count(got, "\n") != 2 {
+		t.Errorf("the file was changed:\n%s", got)
+	}
+}
+
+func TestSeriesJSON(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "temps.log")
+	writeSeries(t, fileName, "", []string{"temp", "sensor"},
+		map[string]string{"temp": "45.5", "sensor": "cpu"},
+		map[string]string{"temp": "47"})
+
+	want := `{"sensor":"cpu","temp":45.5,"time":"2021-12-18T10:00:00Z"}` + "\n" +
+		`{"temp":47,"time":"2021-12-18T10:00:01Z"}` + "\n"
+	if got := readFile(t, fileName); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSeriesFormat(t *testing.T) {
+	dir := t.TempDir()
+
+	// A .csv file can still be written as JSON lines when asked for
+	fileName := filepath.Join(dir, "temps.csv")
+	writeSeries(t, fileName, "json", []string{"temp"}, map[string]string{"temp": "45"})
+	if got := readFile(t, fileName); !strings.HasPrefix(got, "{") {
+		t.Errorf("got %q, want JSON lines", got)
+	}
+
+	if _, err := NewSeries(filepath.Join(dir, "temps.xml"), "xml", []string{"temp"}); err == nil {
+		t.Error("an unknown format was accepted")
+	}
+}
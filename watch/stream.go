@@ -0,0 +1,54 @@
+package watch
+
+import (
+	"context"
+	"time"
+
+	"github.com/dooferlad/jat/shell"
+	"github.com/sirupsen/logrus"
+)
+
+// healthyRun is how long a streamed command has to run before it is considered to have
+// started properly, resetting the restart backoff
+const healthyRun = time.Minute
+
+// restartBackoff is how long Follow waits before restarting a command, a variable so tests
+// don't have to wait
+var restartBackoff = Backoff{Min: time.Second, Max: time.Minute, Jitter: 0.2}
+
+// Follow runs a long-running command, passing each line of its output to line, and starts
+// it again whenever it exits, waiting longer each time it exits quickly. Each time the
+// command exits, exited is called with the error it returned; Follow stops if exited
+// returns false, or when ctx is cancelled.
+func Follow(ctx context.Context, r shell.Runner, line func(stream, text string), exited func(err error) bool, cmd string, arg ...string) {
+	backoff := restartBackoff
+
+	for {
+		start := time.Now()
+		err := r.Stream(ctx, line, cmd, arg...)
+		if ctx.Err() != nil {
+			return
+		}
+
+		entry := logrus.WithField("exit_code", shell.ExitCode(err))
+		if err != nil {
+			entry = entry.WithError(err)
+		}
+		entry.Warnf("%s exited", cmd)
+		if !exited(err) {
+			return
+		}
+
+		if time.Since(start) > healthyRun {
+			backoff.Reset()
+		}
+		wait := backoff.Next()
+		logrus.Infof("restarting %s in %s", cmd, wait.Round(time.Millisecond))
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package watch
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dooferlad/jat/shell"
+)
+
+func fastRestarts(t *testing.T) {
+	old := restartBackoff
+	restartBackoff = Backoff{Min: time.Millisecond, Max: time.Millisecond}
+	t.Cleanup(func() { restartBackoff = old })
+}
+
+func TestFollowRestarts(t *testing.T) {
+	fastRestarts(t)
+
+	f := shell.NewFake().On("journalctl -f", shell.Response{Output: []byte("one\ntwo\n"), ExitCode: 1})
+
+	var lines []string
+	var codes []int
+	Follow(context.Background(), f, func(stream, text string) {
+		lines = append(lines, stream+": "+text)
+	}, func(err error) bool {
+		codes = append(codes, shell.ExitCode(err))
+		return len(codes) < 3
+	}, "journalctl", "-f")
+
+	want := []string{"stdout: one", "stdout: two", "stdout: one", "stdout: two", "stdout: one", "stdout: two"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("got lines %q, want %q", lines, want)
+	}
+	if !reflect.DeepEqual(codes, []int{1, 1, 1}) {
+		t.Errorf("got exit codes %v, want the command to exit three times with 1", codes)
+	}
+	if calls := f.Calls(); len(calls) != 3 || !calls[0].Stream {
+		t.Errorf("got calls %+v, want three streams", calls)
+	}
+}
+
+func TestFollowStopsWhenCancelled(t *testing.T) {
+	fastRestarts(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	f := shell.NewFake().On("journalctl -f", shell.Response{Output: []byte("line\n")})
+
+	runs := 0
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Follow(ctx, f, func(stream, text string) {
+			if runs++; runs == 2 {
+				cancel()
+			}
+		}, func(err error) bool {
+			return true
+		}, "journalctl", "-f")
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Follow didn't stop when its context was cancelled")
+	}
+	if runs != 2 {
+		t.Errorf("command ran %d times, want 2", runs)
+	}
+}
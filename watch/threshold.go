@@ -0,0 +1,104 @@
+package watch
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// thresholdPattern matches "FIELD OP VALUE [for N samples] [hysteresis H]"
+var thresholdPattern = regexp.MustCompile(`^\s*(\w+)\s*(>=|<=|>|<)\s*(-?[0-9.]+)(?:\s+for\s+(\d+)\s+samples?)?(?:\s+hysteresis\s+([0-9.]+))?\s*$`)
+
+// Threshold decides when a field extracted from a watch is out of bounds. It goes active
+// once the condition has held for Samples samples in a row, and inactive again once the
+// field has come back past the threshold by Hysteresis for as many samples, so a value
+// hovering around the threshold doesn't flap.
+type Threshold struct {
+	Field      string
+	Op         string
+	Value      float64
+	Samples    int
+	Hysteresis float64
+
+	active bool
+	// run is how many samples in a row have pointed to a change of state
+	run int
+}
+
+// ParseThreshold reads an expression like "temp > 80 for 3 samples hysteresis 5"
+func ParseThreshold(expr string) (*Threshold, error) {
+	m := thresholdPattern.FindStringSubmatch(expr)
+	if m == nil {
+		return nil, fmt.Errorf("threshold %q: expected FIELD OP VALUE [for N samples] [hysteresis H]", expr)
+	}
+
+	t := Threshold{
+		Field:   m[1],
+		Op:      m[2],
+		Samples: 1,
+	}
+
+	var err error
+	if t.Value, err = strconv.ParseFloat(m[3], 64); err != nil {
+		return nil, fmt.Errorf("threshold %q: %s", expr, err)
+	}
+	if m[4] != "" {
+		if t.Samples, err = strconv.Atoi(m[4]); err != nil || t.Samples < 1 {
+			return nil, fmt.Errorf("threshold %q: samples must be at least 1", expr)
+		}
+	}
+	if m[5] != "" {
+		if t.Hysteresis, err = strconv.ParseFloat(m[5], 64); err != nil {
+			return nil, fmt.Errorf("threshold %q: %s", expr, err)
+		}
+	}
+
+	return &t, nil
+}
+
+// compare applies the threshold's operator to v and limit
+func (t *Threshold) compare(v, limit float64) bool {
+	switch t.Op {
+	case ">":
+		return v > limit
+	case ">=":
+		return v >= limit
+	case "<":
+		return v < limit
+	default:
+		return v <= limit
+	}
+}
+
+// Sample feeds the threshold the fields extracted from one run of the watched command and
+// returns whether it is active. Samples without a numeric value for the field are ignored.
+func (t *Threshold) Sample(fields map[string]string) bool {
+	v, err := strconv.ParseFloat(fields[t.Field], 64)
+	if err != nil {
+		return t.active
+	}
+
+	var changing bool
+	if t.active {
+		// Stay active until the value is back past the threshold by the hysteresis
+		limit := t.Value - t.Hysteresis
+		if t.Op == "<" || t.Op == "<=" {
+			limit = t.Value + t.Hysteresis
+		}
+		changing = !t.compare(v, limit)
+	} else {
+		changing = t.compare(v, t.Value)
+	}
+
+	if !changing {
+		t.run = 0
+		return t.active
+	}
+
+	t.run++
+	if t.run >= t.Samples {
+		t.active = !t.active
+		t.run = 0
+	}
+	return t.active
+}
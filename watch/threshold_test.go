@@ -0,0 +1,111 @@
+package watch
+
+import (
+	"testing"
+)
+
+func TestParseThreshold(t *testing.T) {
+	for _, test := range []struct {
+		expr string
+		want Threshold
+		bad  bool
+	}{
+		{expr: "temp > 80", want: Threshold{Field: "temp", Op: ">", Value: 80, Samples: 1}},
+		{expr: "temp>80", want: Threshold{Field: "temp", Op: ">", Value: 80, Samples: 1}},
+		{expr: "load >= 1.5 for 3 samples", want: Threshold{Field: "load", Op: ">=", Value: 1.5, Samples: 3}},
+		{expr: "free < 10 for 1 sample", want: Threshold{Field: "free", Op: "<", Value: 10, Samples: 1}},
+		{expr: " temp > 80 for 3 samples hysteresis 5 ", want: Threshold{Field: "temp", Op: ">", Value: 80, Samples: 3, Hysteresis: 5}},
+		{expr: "delta <= -2.5 hysteresis 0.5", want: Threshold{Field: "delta", Op: "<=", Value: -2.5, Samples: 1, Hysteresis: 0.5}},
+		{expr: "temp = 80", bad: true},
+		{expr: "temp > hot", bad: true},
+		{expr: "temp > 80 for 0 samples", bad: true},
+		{expr: "temp > 1.2.3", bad: true},
+		{expr: "temp > 80 hysteresis 5 for 3 samples", bad: true},
+		{expr: "", bad: true},
+	} {
+		got, err := ParseThreshold(test.expr)
+		if test.bad {
+			if err == nil {
+				t.Errorf("ParseThreshold(%q) = %+v, want an error", test.expr, *got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseThreshold(%q): %s", test.expr, err)
+			continue
+		}
+		if *got != test.want {
+			t.Errorf("ParseThreshold(%q) = %+v, want %+v", test.expr, *got, test.want)
+		}
+	}
+}
+
+func TestThresholdSample(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		expr    string
+		samples []string
+		// want is the state after each sample, '1' for active
+		want string
+	}{
+		{
+			name:    "single sample",
+			expr:    "temp > 80",
+			samples: []string{"79", "81", "80", "81"},
+			want:    "0101",
+		},
+		{
+			name:    "samples in a row",
+			expr:    "temp > 80 for 3 samples",
+			samples: []string{"81", "82", "79", "81", "82", "83", "84", "70", "70", "85", "70"},
+			want:    "00000111111",
+		},
+		{
+			name:    "hysteresis",
+			expr:    "temp > 80 hysteresis 5",
+			samples: []string{"81", "79", "76", "75", "74", "79", "81"},
+			want:    "1110001",
+		},
+		{
+			name:    "hysteresis and samples",
+			expr:    "temp > 80 for 2 samples hysteresis 5",
+			samples: []string{"81", "81", "70", "78", "70", "70", "81"},
+			want:    "0111100",
+		},
+		{
+			name:    "below",
+			expr:    "free < 10 hysteresis 2",
+			samples: []string{"12", "9", "11", "12", "13"},
+			want:    "01100",
+		},
+		{
+			name:    "non-numeric samples are ignored",
+			expr:    "temp > 80 for 2 samples",
+			samples: []string{"81", "", "n/a", "82", "-", "79"},
+			want:    "000111",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			th, err := ParseThreshold(test.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := ""
+			for _, v := range test.samples {
+				fields := map[string]string{}
+				if v != "" {
+					fields[th.Field] = v
+				}
+				if th.Sample(fields) {
+					got += "1"
+				} else {
+					got += "0"
+				}
+			}
+			if got != test.want {
+				t.Errorf("for %q got %s, want %s", test.samples, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dooferlad/jat/shell"
+)
+
+// SnapshotPrefix starts the name of every snapshot jat takes before upgrading
+const SnapshotPrefix = "jat-pre-upgrade-"
+
+// SnapshotName returns the name of the snapshot for an upgrade started at t
+func SnapshotName(t time.Time) string {
+	return SnapshotPrefix + t.Format("20060102-150405")
+}
+
+// Snapshot takes a recursive snapshot called name of each dataset
+func Snapshot(ctx context.Context, r shell.Runner, datasets []string, name string) error {
+	for _, dataset := range datasets {
+		if err := r.Sudo(ctx, "zfs", "snapshot", "-r", dataset+"@"+name); err != nil {
+			return fmt.Errorf("snapshotting %s: %s", dataset, err)
+		}
+	}
+	return nil
+}
+
+// Snapshots returns the snapshots of dataset and, if recursive is set, its children, whose
+// names start with prefix. Each is returned as dataset@name, oldest first.
+func Snapshots(ctx context.Context, r shell.Runner, dataset, prefix string, recursive bool) ([]string, error) {
+	args := []string{"zfs", "list", "-H", "-t", "snapshot", "-o", "name", "-s", "creation"}
+	if recursive {
+		args = append(args, "-r")
+	} else {
+		args = append(args, "-d", "1")
+	}
+	out, err := r.Capture(ctx, "sudo", append(args, dataset)...)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []string
+	for _, line := range strings.Split(string(out), "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "@", 2)
+		if len(parts) == 2 && strings.HasPrefix(parts[1], prefix) {
+			snapshots = append(snapshots, line)
+		}
+	}
+	return snapshots, nil
+}
+
+// Prune destroys all but the newest keep pre-upgrade snapshots of each dataset
+func Prune(ctx context.Context, r shell.Runner, datasets []string, keep int) error {
+	for _, dataset := range datasets {
+		snapshots, err := Snapshots(ctx, r, dataset, SnapshotPrefix, false)
+		if err != nil {
+			return err
+		}
+
+		for len(snapshots) > keep {
+			if err := r.Sudo(ctx, "zfs", "destroy", "-r", snapshots[0]); err != nil {
+				return fmt.Errorf("pruning %s: %s", snapshots[0], err)
+			}
+			snapshots = snapshots[1:]
+		}
+	}
+	return nil
+}
+
+// lookPath finds the boot environment tools, a variable so tests can pretend they exist
+var lookPath = exec.LookPath
+
+// RollbackCommands returns the commands that put each dataset, and everything under it,
+// back to the snapshot called name. The running root file system can't be rolled back in
+// place, so for it and its children the commands create a boot environment from the
+// snapshot and make it the one booted next instead.
+func RollbackCommands(ctx context.Context, r shell.Runner, datasets []string, name string) ([]string, error) {
+	root, err := rootDataset(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	var commands, boot []string
+	for _, dataset := range datasets {
+		snapshots, err := Snapshots(ctx, r, dataset, name, true)
+		if err != nil {
+			return nil, err
+		}
+		// Parents before children
+		sort.Slice(snapshots, func(i, j int) bool {
+			return strings.SplitN(snapshots[i], "@", 2)[0] < strings.SplitN(snapshots[j], "@", 2)[0]
+		})
+
+		for _, snapshot := range snapshots {
+			if !strings.HasSuffix(snapshot, "@"+name) {
+				continue
+			}
+			if ds := strings.TrimSuffix(snapshot, "@"+name); root != "" && (ds == root || strings.HasPrefix(ds, root+"/")) {
+				boot = append(boot, ds)
+				continue
+			}
+			commands = append(commands, "sudo zfs rollback -r "+snapshot)
+		}
+	}
+
+	boot = uniq(boot)
+	switch {
+	case len(boot) == 0:
+	case boot[0] == root:
+		commands = append(commands, bootEnvironmentCommands(root, boot, name)...)
+	default:
+		// Only datasets under the root were snapshotted, so there is no boot environment
+		for _, ds := range boot {
+			commands = append(commands, "sudo zfs rollback -r "+ds+"@"+name)
+		}
+	}
+	return commands, nil
+}
+
+// rootDataset returns the dataset mounted on /, or "" if / isn't on ZFS
+func rootDataset(ctx context.Context, r shell.Runner) (string, error) {
+	out, err := r.Capture(ctx, "findmnt", "--noheadings", "--output", "FSTYPE,SOURCE", "/")
+	if err != nil {
+		return "", fmt.Errorf("finding the root file system: %s", err)
+	}
+
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 || fields[0] != "zfs" {
+		return "", nil
+	}
+	return fields[1], nil
+}
+
+// bootEnvironmentCommands returns the commands that boot the root dataset, whose snapshotted
+// datasets (itself and its children, parents first) are listed in datasets, as it was at
+// snapshot name. bectl and zsys manage boot environments themselves; otherwise the snapshots
+// are cloned and the pool's bootfs pointed at the clone.
+func bootEnvironmentCommands(root string, datasets []string, name string) []string {
+	be := path.Base(root)
+	clone := root + "-" + strings.TrimPrefix(name, SnapshotPrefix)
+
+	if _, err := lookPath("bectl"); err == nil {
+		newBE := path.Base(clone)
+		return []string{
+			"sudo bectl create -r -e " + be + "@" + name + " " + newBE,
+			"sudo bectl activate " + newBE,
+		}
+	}
+
+	if _, err := lookPath("zsysctl"); err == nil {
+		return []string{
+			"zsysctl show",
+			"# reboot and pick the @" + name + " state of " + be + " from the boot menu's history entry",
+		}
+	}
+
+	// canmount=noauto stops the clones being mounted over the running system
+	commands := []string{
+		"sudo zfs clone -o canmount=noauto -o mountpoint=/ " + root + "@" + name + " " + clone,
+	}
+	for _, ds := range datasets[1:] {
+		commands = append(commands, "sudo zfs clone -o canmount=noauto "+ds+"@"+name+" "+clone+strings.TrimPrefix(ds, root))
+	}
+	pool := strings.SplitN(root, "/", 2)[0]
+	return append(commands, "sudo zpool set bootfs="+clone+" "+pool)
+}
+
+// uniq sorts list, so parents come before children, and removes duplicates
+func uniq(list []string) []string {
+	sort.Strings(list)
+	var result []string
+	for i, s := range list {
+		if i == 0 || s != list[i-1] {
+			result = append(result, s)
+		}
+	}
+	return result
+}
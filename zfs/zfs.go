@@ -2,6 +2,7 @@ package zfs
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"reflect"
 	"strings"
@@ -64,8 +65,8 @@ func unwrap(wrapped []byte, v interface{}) error {
 	return nil
 }
 
-func List() (*map[string]Listing, error) {
-	out, err := shell.Capture("sudo", "zfs", "list", "-H")
+func List(ctx context.Context, r shell.Runner) (*map[string]Listing, error) {
+	out, err := r.Capture(ctx, "sudo", "zfs", "list", "-H")
 	if err != nil {
 		return nil, err
 	}
@@ -78,3 +79,26 @@ func List() (*map[string]Listing, error) {
 
 	return listing, err
 }
+
+// Activity returns a description of each scrub or resilver in progress
+func Activity(ctx context.Context, r shell.Runner) ([]string, error) {
+	out, err := r.Capture(ctx, "zpool", "status")
+	if err != nil {
+		return nil, err
+	}
+
+	var activity []string
+	var pool string
+	scanner := bufio.NewScanner(strings.NewReader(string(out)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "pool:") {
+			pool = strings.TrimSpace(strings.TrimPrefix(line, "pool:"))
+		}
+		if strings.HasPrefix(line, "scan:") && strings.Contains(line, "in progress") {
+			activity = append(activity, pool+": "+strings.TrimSpace(strings.TrimPrefix(line, "scan:")))
+		}
+	}
+
+	return activity, scanner.Err()
+}
@@ -0,0 +1,162 @@
+package zfs
+
+import (
+	"context"
+	"os/exec"
+	"reflect"
+	"testing"
+
+	"github.com/dooferlad/jat/shell"
+)
+
+func TestList(t *testing.T) {
+	f := shell.NewFake().On("sudo zfs list -H", shell.Response{Output: []byte(
+		"rpool\t10G\t90G\t96K\t/\n" +
+			"rpool/ROOT/ubuntu\t8G\t90G\t8G\t/\n")})
+
+	listing, err := List(context.Background(), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]Listing{
+		"rpool":             {Name: "rpool", Used: "10G", Avail: "90G", Refer: "96K", Mountpoint: "/"},
+		"rpool/ROOT/ubuntu": {Name: "rpool/ROOT/ubuntu", Used: "8G", Avail: "90G", Refer: "8G", Mountpoint: "/"},
+	}
+	if !reflect.DeepEqual(*listing, want) {
+		t.Errorf("got %+v, want %+v", *listing, want)
+	}
+	if calls := f.Calls(); len(calls) != 1 || !calls[0].Capture {
+		t.Errorf("got calls %+v, want one capture", calls)
+	}
+}
+
+func TestActivity(t *testing.T) {
+	f := shell.NewFake().On("zpool status", shell.Response{Output: []byte(`  pool: bpool
+ state: ONLINE
+  scan: scrub repaired 0B in 00:00:01 with 0 errors on Sun Dec 12 00:24:02 2021
+config:
+
+  pool: rpool
+ state: ONLINE
+  scan: resilver in progress since Sat Dec 18 10:00:00 2021
+	1.2T scanned at 500M/s, 600G issued at 250M/s, 2T total
+`)})
+
+	got, err := Activity(context.Background(), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"rpool: resilver in progress since Sat Dec 18 10:00:00 2021"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSnapshotAndPrune(t *testing.T) {
+	f := shell.NewFake().On("sudo zfs list -H -t snapshot -o name -s creation -d 1 rpool/ROOT", shell.Response{Output: []byte(
+		"rpool/ROOT@jat-pre-upgrade-20211201-030000\n" +
+			"rpool/ROOT@manual\n" +
+			"rpool/ROOT@jat-pre-upgrade-20211208-030000\n" +
+			"rpool/ROOT@jat-pre-upgrade-20211215-030000\n")})
+
+	ctx := context.Background()
+	if err := Snapshot(ctx, f, []string{"rpool/ROOT"}, "jat-pre-upgrade-20211215-030000"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Prune(ctx, f, []string{"rpool/ROOT"}, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"sudo zfs snapshot -r rpool/ROOT@jat-pre-upgrade-20211215-030000",
+		"sudo zfs list -H -t snapshot -o name -s creation -d 1 rpool/ROOT",
+		"sudo zfs destroy -r rpool/ROOT@jat-pre-upgrade-20211201-030000",
+	}
+	if !reflect.DeepEqual(f.CommandLines(), want) {
+		t.Errorf("ran %q, want %q", f.CommandLines(), want)
+	}
+}
+
+func TestRollbackCommands(t *testing.T) {
+	f := shell.NewFake().On("sudo zfs list -H -t snapshot -o name -s creation -r rpool/ROOT", shell.Response{Output: []byte(
+		"rpool/ROOT/ubuntu@jat-pre-upgrade-1\n" +
+			"rpool/ROOT@jat-pre-upgrade-1\n" +
+			"rpool/ROOT/ubuntu@jat-pre-upgrade-10\n")})
+
+	got, err := RollbackCommands(context.Background(), f, []string{"rpool/ROOT"}, "jat-pre-upgrade-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"sudo zfs rollback -r rpool/ROOT@jat-pre-upgrade-1",
+		"sudo zfs rollback -r rpool/ROOT/ubuntu@jat-pre-upgrade-1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRollbackBootEnvironment(t *testing.T) {
+	snapshots := "rpool/ROOT@jat-pre-upgrade-20211215-030000\n" +
+		"rpool/ROOT/ubuntu@jat-pre-upgrade-20211215-030000\n" +
+		"rpool/ROOT/ubuntu/var@jat-pre-upgrade-20211215-030000\n"
+
+	for _, test := range []struct {
+		name  string
+		tools []string
+		want  []string
+	}{
+		{
+			name: "plain zfs",
+			want: []string{
+				"sudo zfs rollback -r rpool/ROOT@jat-pre-upgrade-20211215-030000",
+				"sudo zfs clone -o canmount=noauto -o mountpoint=/ rpool/ROOT/ubuntu@jat-pre-upgrade-20211215-030000 rpool/ROOT/ubuntu-20211215-030000",
+				"sudo zfs clone -o canmount=noauto rpool/ROOT/ubuntu/var@jat-pre-upgrade-20211215-030000 rpool/ROOT/ubuntu-20211215-030000/var",
+				"sudo zpool set bootfs=rpool/ROOT/ubuntu-20211215-030000 rpool",
+			},
+		},
+		{
+			name:  "bectl",
+			tools: []string{"bectl"},
+			want: []string{
+				"sudo zfs rollback -r rpool/ROOT@jat-pre-upgrade-20211215-030000",
+				"sudo bectl create -r -e ubuntu@jat-pre-upgrade-20211215-030000 ubuntu-20211215-030000",
+				"sudo bectl activate ubuntu-20211215-030000",
+			},
+		},
+		{
+			name:  "zsys",
+			tools: []string{"zsysctl"},
+			want: []string{
+				"sudo zfs rollback -r rpool/ROOT@jat-pre-upgrade-20211215-030000",
+				"zsysctl show",
+				"# reboot and pick the @jat-pre-upgrade-20211215-030000 state of ubuntu from the boot menu's history entry",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			lookPath = func(file string) (string, error) {
+				for _, tool := range test.tools {
+					if file == tool {
+						return "/usr/sbin/" + tool, nil
+					}
+				}
+				return "", exec.ErrNotFound
+			}
+			defer func() { lookPath = exec.LookPath }()
+
+			f := shell.NewFake().
+				On("findmnt --noheadings --output FSTYPE,SOURCE /", shell.Response{Output: []byte("zfs    rpool/ROOT/ubuntu\n")}).
+				On("sudo zfs list -H -t snapshot -o name -s creation -r rpool/ROOT", shell.Response{Output: []byte(snapshots)})
+
+			got, err := RollbackCommands(context.Background(), f, []string{"rpool/ROOT"}, "jat-pre-upgrade-20211215-030000")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}